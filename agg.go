@@ -0,0 +1,122 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// Functions of per-column aggregations like "rss:sum" in --agg.
+const (
+	aggFuncMin = "min"
+	aggFuncMax = "max"
+	aggFuncSum = "sum"
+)
+
+// isColumnAggs reports whether values of --agg are per-column aggregations
+// like "rss:sum,pcpu:max" rather than a single aggregation like "min".
+func isColumnAggs(specs []string) bool {
+	return slices.ContainsFunc(specs, func(spec string) bool {
+		return strings.Contains(spec, ":")
+	})
+}
+
+// parseColumnAggs parses specs like "rss:sum" to a map from fields to
+// aggregation functions. Every column must have exactly one aggregation.
+func parseColumnAggs(specs []string, columns []Column) (map[string]string, error) {
+	aggs := make(map[string]string, len(specs))
+	for _, spec := range specs {
+		field, fn, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid value for flag --agg: %s, must be like \"rss:sum\" with other columns", spec)
+		}
+		if !slices.ContainsFunc(columns, func(column Column) bool { return column.Field == field }) {
+			return nil, fmt.Errorf("invalid value for flag --agg: %s, %s is not in columns", spec, field)
+		}
+		if _, dup := aggs[field]; dup {
+			return nil, fmt.Errorf("invalid value for flag --agg: %s, %s is aggregated more than once", spec, field)
+		}
+		switch fn {
+		case aggFuncMin, aggFuncMax:
+		case aggFuncSum:
+			if def, ok := lookupFieldDef(field); !ok || !isSummableField(def) {
+				return nil, fmt.Errorf("invalid value for flag --agg: %s, %s cannot be summed", spec, field)
+			}
+		default:
+			return nil, fmt.Errorf("invalid value for flag --agg: %s, function must be %q, %q, or %q",
+				spec, aggFuncMin, aggFuncMax, aggFuncSum)
+		}
+		aggs[field] = fn
+	}
+	for _, column := range columns {
+		if _, ok := aggs[column.Field]; !ok {
+			return nil, fmt.Errorf("flag --agg has no aggregation for column %s", column.Field)
+		}
+	}
+	return aggs, nil
+}
+
+// isSummableField reports whether values of the field can be summed. Numeric
+// identifiers like pids and CPU numbers, and priorities are not summable.
+func isSummableField(def *procfs.FieldDef) bool {
+	switch def.Name {
+	case fieldPID, fieldPPID, fieldCPU, fieldRTPrio:
+		return false
+	default:
+		return isNumericField(def)
+	}
+}
+
+// aggregateColumns returns a single data with values of each field
+// aggregated by its function in aggs. Missing values are ignored, and the
+// value is missing if all values are missing, e.g. for no processes.
+func aggregateColumns(dataList []map[string]any, aggs map[string]string) []map[string]any {
+	result := make(map[string]any, len(aggs))
+	for field, fn := range aggs {
+		var acc any
+		for _, data := range dataList {
+			value := data[field]
+			if value == nil {
+				continue
+			}
+			switch {
+			case acc == nil:
+				acc = value
+			case fn == aggFuncMin && compareValues(value, acc) < 0,
+				fn == aggFuncMax && compareValues(value, acc) > 0:
+				acc = value
+			case fn == aggFuncSum:
+				acc = addValues(acc, value)
+			}
+		}
+		if acc != nil {
+			result[field] = acc
+		}
+	}
+	return []map[string]any{result}
+}
+
+// addValues returns the sum of typed values in data of the same type.
+// Unlimited bytes stay unlimited.
+func addValues(a, b any) any {
+	switch a := a.(type) {
+	case int:
+		return a + b.(int)
+	case uint64:
+		if a == unlimitedBytes || b.(uint64) == unlimitedBytes {
+			return uint64(unlimitedBytes)
+		}
+		return a + b.(uint64)
+	case procfs.Percent:
+		return a + b.(procfs.Percent)
+	case time.Duration:
+		return a + b.(time.Duration)
+	default:
+		return a
+	}
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseColumnAggs(t *testing.T) {
+	columns := []Column{{Field: fieldPID}, {Field: fieldPPID}, {Field: fieldRSS}, {Field: fieldCPU}, {Field: fieldRTPrio}}
+	testCases := []struct {
+		specs   []string
+		wantErr string
+	}{
+		{specs: []string{"pid:min", "ppid:max", "rss:sum", "cpu:min", "rtprio:max"}},
+		{specs: []string{"pid:sum", "ppid:max", "rss:sum", "cpu:min", "rtprio:max"}, wantErr: "pid cannot be summed"},
+		{specs: []string{"pid:min", "ppid:sum", "rss:sum", "cpu:min", "rtprio:max"}, wantErr: "ppid cannot be summed"},
+		{specs: []string{"pid:min", "ppid:max", "rss:sum", "cpu:sum", "rtprio:max"}, wantErr: "cpu cannot be summed"},
+		{specs: []string{"pid:min", "ppid:max", "rss:sum", "cpu:min", "rtprio:sum"}, wantErr: "rtprio cannot be summed"},
+		{specs: []string{"pid:min", "ppid:max", "rss:avg", "cpu:min", "rtprio:max"}, wantErr: "function must be"},
+		{specs: []string{"pid:min", "ppid:max", "rss:sum"}, wantErr: "no aggregation for column cpu"},
+	}
+	for _, tc := range testCases {
+		aggs, err := parseColumnAggs(tc.specs, columns)
+		switch {
+		case tc.wantErr == "" && err != nil:
+			t.Errorf("%q: %s", tc.specs, err)
+		case tc.wantErr == "" && len(aggs) != len(columns):
+			t.Errorf("%q: got %v", tc.specs, aggs)
+		case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+			t.Errorf("%q: got error %v, want %q", tc.specs, err, tc.wantErr)
+		}
+	}
+}
+
+func TestAggregateDataListMinBreaksTiesByPID(t *testing.T) {
+	// Processes started in the same second of the uptime resolution.
+	dataList := []map[string]any{
+		{fieldPID: 30, fieldUptime: 5 * time.Second},
+		{fieldPID: 10, fieldUptime: 5 * time.Second},
+		{fieldPID: 20, fieldUptime: 5 * time.Second},
+		{fieldPID: 1, fieldUptime: time.Hour},
+	}
+	for range 2 {
+		got := aggregateDataList(dataList, aggMin)
+		if len(got) != 1 || got[0][fieldPID] != 10 {
+			t.Errorf("got %v, want pid 10", got)
+		}
+		slices.Reverse(dataList)
+	}
+
+	got := aggregateDataList(nil, aggMin)
+	if len(got) != 1 || got[0][fieldUptime] != time.Duration(0) {
+		t.Errorf("got %v, want zero uptime for no processes", got)
+	}
+}
@@ -1,8 +1,13 @@
+//go:build linux
+
 package main
 
 import (
 	"errors"
 	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
 )
 
 type Align int
@@ -10,18 +15,44 @@ type Align int
 const (
 	AlignLeft Align = iota
 	AlignRight
+	// AlignDecimal aligns numbers like "1.5" and "12.25" on the decimal
+	// point. Other values like the header are aligned right.
+	AlignDecimal
 )
 
 func AlignColumns(rows [][]string, alignments []Align) ([][]string, error) {
+	return AlignColumnsWithWidths(rows, alignments, nil, nil)
+}
+
+// AlignColumnsWithWidths is same as AlignColumns except that the width
+// of each column is at least the value in minWidths, and values longer
+// than the value in maxWidths are truncated with an ellipsis.
+// A zero value in maxWidths means unlimited. minWidths and maxWidths may
+// be nil or shorter than the column count.
+func AlignColumnsWithWidths(rows [][]string, alignments []Align, minWidths, maxWidths []int) ([][]string, error) {
+	for i, row := range rows {
+		if len(row) != len(alignments) {
+			return nil, fmt.Errorf("column count %d in row %d does not match alignments count %d",
+				len(row), i, len(alignments))
+		}
+	}
+	if slices.ContainsFunc(maxWidths, func(w int) bool { return w > 0 }) {
+		rows = truncateColumns(rows, maxWidths)
+	}
+	if slices.Contains(alignments, AlignDecimal) {
+		rows = padDecimalColumns(rows, alignments)
+	}
 	widths, err := columnWidths(rows)
 	if err != nil {
 		return nil, err
 	}
+	for j, minWidth := range minWidths {
+		if j < len(widths) {
+			widths[j] = max(widths[j], minWidth)
+		}
+	}
 	alignedRows := make([][]string, len(rows))
 	for i, row := range rows {
-		if i == 0 && len(row) != len(alignments) {
-			return nil, errors.New("alignments count must be match to column count in rows")
-		}
 		alignedRows[i] = make([]string, len(row))
 		for j, col := range row {
 			switch alignments[j] {
@@ -31,7 +62,7 @@ func AlignColumns(rows [][]string, alignments []Align) ([][]string, error) {
 				} else {
 					alignedRows[i][j] = fmt.Sprintf("%-*s", widths[j], col)
 				}
-			case AlignRight:
+			case AlignRight, AlignDecimal:
 				alignedRows[i][j] = fmt.Sprintf("%*s", widths[j], col)
 			}
 		}
@@ -49,12 +80,80 @@ func columnWidths(rows [][]string) ([]int, error) {
 		if i == 0 {
 			widths = make([]int, len(row))
 		} else if len(row) != len(widths) {
-			return nil, errors.New("all column count must be same in rows")
+			return nil, fmt.Errorf("column count %d in row %d does not match %d in row 0",
+				len(row), i, len(widths))
 		}
 
 		for j, col := range row {
-			widths[j] = max(widths[j], len(col))
+			// Use the rune count since fmt pads with the rune count.
+			widths[j] = max(widths[j], utf8.RuneCountInString(col))
 		}
 	}
 	return widths, nil
 }
+
+// padDecimalColumns pads the fractional parts of numbers in columns with
+// AlignDecimal with trailing spaces to the same width, so that they are
+// aligned on the decimal point after they are aligned right.
+func padDecimalColumns(rows [][]string, alignments []Align) [][]string {
+	paddedRows := make([][]string, len(rows))
+	for i, row := range rows {
+		paddedRows[i] = slices.Clone(row)
+	}
+	for j, align := range alignments {
+		if align != AlignDecimal {
+			continue
+		}
+		var maxFracLen int
+		for _, row := range rows {
+			if frac, ok := decimalFraction(row[j]); ok {
+				maxFracLen = max(maxFracLen, len(frac))
+			}
+		}
+		for i, row := range rows {
+			if frac, ok := decimalFraction(row[j]); ok {
+				paddedRows[i][j] = row[j] + strings.Repeat(" ", maxFracLen-len(frac))
+			}
+		}
+	}
+	return paddedRows
+}
+
+// decimalFraction returns the fractional part with the decimal point like
+// ".25" of a number like "12.25", or "" for an integer. ok is false if s is
+// not a plain decimal number, e.g. "NaN", "Inf", or "1e5".
+func decimalFraction(s string) (frac string, ok bool) {
+	if !decimalNumberRegexp.MatchString(s) {
+		return "", false
+	}
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		return s[i:], true
+	}
+	return "", true
+}
+
+func truncateColumns(rows [][]string, maxWidths []int) [][]string {
+	truncatedRows := make([][]string, len(rows))
+	for i, row := range rows {
+		truncatedRows[i] = make([]string, len(row))
+		for j, col := range row {
+			if j < len(maxWidths) && maxWidths[j] > 0 {
+				col = truncateWithEllipsis(col, maxWidths[j])
+			}
+			truncatedRows[i][j] = col
+		}
+	}
+	return truncatedRows
+}
+
+func truncateWithEllipsis(s string, maxLen int) string {
+	const ellipsis = "..."
+	runes := []rune(s)
+	if len(runes) <= maxLen {
+		return s
+	}
+	if maxLen <= len(ellipsis) {
+		return string(runes[:maxLen])
+	}
+	return string(runes[:maxLen-len(ellipsis)]) + ellipsis
+}
@@ -0,0 +1,131 @@
+//go:build linux
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestTruncateColumnsAtRuneBoundaries(t *testing.T) {
+	rows := [][]string{
+		{"PID", "COMMAND"},
+		{"1", "日本語のコマンド"},
+		{"2", "node"},
+	}
+	got := truncateColumns(rows, []int{0, 6})
+	// The header is truncated same as values.
+	want := [][]string{
+		{"PID", "COM..."},
+		{"1", "日本語..."},
+		{"2", "node"},
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if rows[1][1] != "日本語のコマンド" {
+		t.Errorf("rows are modified to %q", rows)
+	}
+}
+
+func TestTruncateWithEllipsis(t *testing.T) {
+	testCases := []struct {
+		s      string
+		maxLen int
+		want   string
+	}{
+		{s: "node", maxLen: 4, want: "node"},
+		{s: "node server.js", maxLen: 8, want: "node ..."},
+		{s: "日本語のコマンド", maxLen: 8, want: "日本語のコマンド"},
+		{s: "日本語のコマンド", maxLen: 7, want: "日本語の..."},
+		// Too short for the ellipsis.
+		{s: "日本語のコマンド", maxLen: 2, want: "日本"},
+	}
+	for _, tc := range testCases {
+		if got := truncateWithEllipsis(tc.s, tc.maxLen); got != tc.want {
+			t.Errorf("truncateWithEllipsis(%q, %d) = %q, want %q", tc.s, tc.maxLen, got, tc.want)
+		}
+	}
+}
+
+func TestDecimalFraction(t *testing.T) {
+	testCases := []struct {
+		s      string
+		want   string
+		wantOK bool
+	}{
+		{s: "12.25", want: ".25", wantOK: true},
+		{s: "-0.5", want: ".5", wantOK: true},
+		{s: "+3.0", want: ".0", wantOK: true},
+		{s: "42", want: "", wantOK: true},
+		{s: "NaN"},
+		{s: "Inf"},
+		{s: "-Inf"},
+		{s: "1e5"},
+		{s: "1.5e-3"},
+		{s: "0x1F"},
+		{s: "1."},
+		{s: ".5"},
+		{s: missingValue},
+		{s: "8.7 MiB"},
+	}
+	for _, tc := range testCases {
+		got, ok := decimalFraction(tc.s)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("decimalFraction(%q) = %q, %v, want %q, %v", tc.s, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestPadDecimalColumns(t *testing.T) {
+	rows := [][]string{{"12.25"}, {"3.5"}, {"7"}, {"NaN"}, {"1e5"}}
+	got := padDecimalColumns(rows, []Align{AlignDecimal})
+	want := [][]string{{"12.25"}, {"3.5 "}, {"7   "}, {"NaN"}, {"1e5"}}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAlignColumnsWithMaxWidths(t *testing.T) {
+	rows := [][]string{
+		{"COMMAND", "PID"},
+		{"日本語のコマンド", "1"},
+	}
+	got, err := AlignColumnsWithWidths(rows, []Align{AlignLeft, AlignRight}, nil, []int{7, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The width is the rune count of the truncated values.
+	want := [][]string{
+		{"COMMAND", "PID"},
+		{"日本語の...", "  1"},
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestAlignColumnsMismatchedColumnCount(t *testing.T) {
+	testCases := []struct {
+		name string
+		rows [][]string
+		want string
+	}{
+		{
+			name: "short data row",
+			rows: [][]string{{"PID", "RSS"}, {"1", "8.7 MiB"}, {"2"}},
+			want: "column count 1 in row 2 does not match alignments count 2",
+		},
+		{
+			name: "long header",
+			rows: [][]string{{"PID", "RSS", "COMMAND"}, {"1", "8.7 MiB"}},
+			want: "column count 3 in row 0 does not match alignments count 2",
+		},
+	}
+	for _, tc := range testCases {
+		_, err := AlignColumns(tc.rows, []Align{AlignRight, AlignRight})
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("%s: got error %v, want %q", tc.name, err, tc.want)
+		}
+	}
+}
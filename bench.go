@@ -0,0 +1,27 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// PhaseTimings holds the elapsed time of each phase in Run for --bench.
+type PhaseTimings struct {
+	PidDiscovery time.Duration
+	Read         procfs.ReadTimings
+	Convert      time.Duration
+	Render       time.Duration
+}
+
+func (t *PhaseTimings) Write(w io.Writer) {
+	fmt.Fprintf(w, "pid discovery: %s\n", t.PidDiscovery)
+	fmt.Fprintf(w, "stat reads:    %s\n", t.Read.Stat())
+	fmt.Fprintf(w, "cmdline reads: %s\n", t.Read.Cmdline())
+	fmt.Fprintf(w, "convert:       %s\n", t.Convert)
+	fmt.Fprintf(w, "rendering:     %s\n", t.Render)
+}
@@ -0,0 +1,188 @@
+//go:build linux
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// cgroupMountPoint is the mount point of the cgroup v2 hierarchy.
+const cgroupMountPoint = "/sys/fs/cgroup"
+
+// cgroupRoot is the directory of the cgroup hierarchy managed by the
+// systemd of the analyzed system, which contains "system.slice". It is
+// set with --cgroup-root or detected with detectCgroupRoot.
+var cgroupRoot = cgroupMountPoint
+
+const cgroupProcsFile = "cgroup.procs"
+
+// cgroupProcsPath returns the path of cgroup.procs for the cgroup specified
+// with --cgroup, which is either an absolute path under cgroupRoot or a path
+// relative to it, with or without the trailing "/cgroup.procs".
+func cgroupProcsPath(cgroup string) (string, error) {
+	p := path.Clean(cgroup)
+	if path.IsAbs(p) {
+		if p != cgroupRoot && !strings.HasPrefix(p, cgroupRoot+"/") {
+			return "", fmt.Errorf("cgroup path must be under %s: %s", cgroupRoot, cgroup)
+		}
+		p = strings.TrimPrefix(strings.TrimPrefix(p, cgroupRoot), "/")
+	} else if p == ".." || strings.HasPrefix(p, "../") {
+		return "", fmt.Errorf("cgroup path must be under %s: %s", cgroupRoot, cgroup)
+	}
+	if p == cgroupProcsFile || strings.HasSuffix(p, "/"+cgroupProcsFile) {
+		p = path.Dir(p)
+	}
+	return path.Join(cgroupRoot, p, cgroupProcsFile), nil
+}
+
+// serviceCgroupDir returns the directory of the cgroup of the service.
+func serviceCgroupDir(service string) string {
+	return path.Join(cgroupRoot, "system.slice", service+".service")
+}
+
+// detectCgroupRoot returns the directory of the cgroup of PID 1 if it is
+// systemd in "init.scope", or cgroupMountPoint otherwise.
+//
+// In a container without a cgroup namespace, the hierarchy of the host is
+// mounted and the cgroup of PID 1 is like "/docker/<id>/init.scope", so
+// services of the systemd in the container are under
+// "/sys/fs/cgroup/docker/<id>/system.slice". On a host or in a container
+// with a cgroup namespace, it is "/init.scope" and cgroupMountPoint is used.
+func detectCgroupRoot() string {
+	filename := procfs.HostPath("/proc/1/cgroup")
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		slog.Debug("cannot detect cgroup root", "file", filename, "err", err)
+		return cgroupMountPoint
+	}
+	cgroup, ok := parseCgroupV2Path(content)
+	if !ok || path.Base(cgroup) != "init.scope" {
+		return cgroupMountPoint
+	}
+	root := path.Join(cgroupMountPoint, path.Dir(cgroup))
+	slog.Debug("detected cgroup root", "file", filename, "cgroupRoot", root)
+	return root
+}
+
+// parseCgroupV2Path returns the path of the cgroup v2 hierarchy in the
+// content of /proc/<pid>/cgroup, which is on the line like "0::/init.scope".
+// https://man7.org/linux/man-pages/man7/cgroups.7.html
+func parseCgroupV2Path(content []byte) (string, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		if cgroup, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			return cgroup, true
+		}
+	}
+	return "", false
+}
+
+// getPidsOfCgroups returns pids in cgroups with the cgroup as given in
+// place of the service name.
+func getPidsOfCgroups(cgroups []string) ([]procfs.ServicePid, error) {
+	var pids []procfs.ServicePid
+	for _, cgroup := range cgroups {
+		filename, err := cgroupProcsPath(cgroup)
+		if err != nil {
+			return nil, err
+		}
+		cgroupPids, err := readCgroupProcs(procfs.HostPath(filename))
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil, fmt.Errorf("no such cgroup: %s", cgroup)
+			}
+			return nil, err
+		}
+		for _, pid := range cgroupPids {
+			pids = append(pids, procfs.ServicePid{Service: cgroup, Pid: pid})
+		}
+	}
+	return pids, nil
+}
+
+// readCgroupProcs returns pids in the cgroup.procs file.
+func readCgroupProcs(filename string) ([]int, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("cannot get pids from %s: %w", filename, err)
+	}
+
+	var pids []int
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := scanner.Text()
+		pid, err := strconv.Atoi(line)
+		if err != nil {
+			return nil, fmt.Errorf("cannot convert pid to int, line=%s, err=%s", line, err)
+		}
+		pids = append(pids, pid)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	slog.Debug("read pids of cgroup", "file", filename, "pids", len(pids))
+	return pids, nil
+}
+
+// readCgroupTasksOfServices returns "tasks" values of services keyed by
+// them. Services whose cgroups do not exist are omitted.
+func readCgroupTasksOfServices(services []string) (map[string]string, error) {
+	tasks := make(map[string]string, len(services))
+	for _, service := range services {
+		if err := validateServiceName(service); err != nil {
+			return nil, err
+		}
+		if err := readCgroupTasks(tasks, service, serviceCgroupDir(service)); err != nil {
+			return nil, err
+		}
+	}
+	return tasks, nil
+}
+
+// readCgroupTasksOfCgroups returns "tasks" values of cgroups keyed by them
+// as given with --cgroup.
+func readCgroupTasksOfCgroups(cgroups []string) (map[string]string, error) {
+	tasks := make(map[string]string, len(cgroups))
+	for _, cgroup := range cgroups {
+		filename, err := cgroupProcsPath(cgroup)
+		if err != nil {
+			return nil, err
+		}
+		if err := readCgroupTasks(tasks, cgroup, path.Dir(filename)); err != nil {
+			return nil, err
+		}
+	}
+	return tasks, nil
+}
+
+// readCgroupTasks sets "current/max" of pids.current and pids.max in dir
+// to tasks[key]. It is not set if the pids controller is not enabled.
+// https://docs.kernel.org/admin-guide/cgroup-v2.html#pid
+func readCgroupTasks(tasks map[string]string, key, dir string) error {
+	values := make([]string, 2)
+	for i, name := range []string{"pids.current", "pids.max"} {
+		filename := procfs.HostPath(path.Join(dir, name))
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				slog.Debug("cgroup file not found", "file", filename)
+				return nil
+			}
+			return fmt.Errorf("cannot read %s: %s", filename, err)
+		}
+		values[i] = strings.TrimSpace(string(content))
+	}
+	tasks[key] = values[0] + "/" + values[1]
+	return nil
+}
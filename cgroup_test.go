@@ -0,0 +1,129 @@
+//go:build linux
+
+package main
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+func TestParseCgroupV2Path(t *testing.T) {
+	testCases := []struct {
+		content string
+		want    string
+		wantOK  bool
+	}{
+		{content: "0::/init.scope\n", want: "/init.scope", wantOK: true},
+		// A hybrid hierarchy has v1 controllers before the v2 line.
+		{content: "12:pids:/docker/0123abcd\n1:name=systemd:/docker/0123abcd/init.scope\n0::/docker/0123abcd/init.scope\n",
+			want: "/docker/0123abcd/init.scope", wantOK: true},
+		// Only cgroup v1.
+		{content: "1:name=systemd:/init.scope\n"},
+	}
+	for _, tc := range testCases {
+		got, ok := parseCgroupV2Path([]byte(tc.content))
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("parseCgroupV2Path(%q) = %q, %v, want %q, %v", tc.content, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+func TestDetectCgroupRoot(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "host", content: "0::/init.scope\n", want: "/sys/fs/cgroup"},
+		{name: "container", content: "0::/docker/0123abcd/init.scope\n", want: "/sys/fs/cgroup/docker/0123abcd"},
+		// PID 1 is not systemd, e.g. a container running a single service.
+		{name: "not systemd", content: "0::/docker/0123abcd\n", want: "/sys/fs/cgroup"},
+		{name: "cgroup v1", content: "1:name=systemd:/init.scope\n", want: "/sys/fs/cgroup"},
+	}
+	for _, tc := range testCases {
+		setFixtureRoot(t, map[string]string{"/proc/1/cgroup": tc.content})
+		if got := detectCgroupRoot(); got != tc.want {
+			t.Errorf("%s: got %q, want %q", tc.name, got, tc.want)
+		}
+	}
+
+	// The mount point is used if /proc/1/cgroup cannot be read.
+	setFixtureRoot(t, nil)
+	if got, want := detectCgroupRoot(), "/sys/fs/cgroup"; got != want {
+		t.Errorf("missing file: got %q, want %q", got, want)
+	}
+}
+
+// setCgroupRoot sets cgroupRoot until the end of the test.
+func setCgroupRoot(t *testing.T, root string) {
+	t.Helper()
+	saved := cgroupRoot
+	cgroupRoot = root
+	t.Cleanup(func() { cgroupRoot = saved })
+}
+
+func TestCgroupProcsPath(t *testing.T) {
+	setCgroupRoot(t, "/sys/fs/cgroup/docker/0123abcd")
+	const root = "/sys/fs/cgroup/docker/0123abcd"
+	testCases := []struct {
+		cgroup string
+		want   string
+	}{
+		{cgroup: "system.slice/nginx.service", want: root + "/system.slice/nginx.service/cgroup.procs"},
+		{cgroup: "system.slice/nginx.service/cgroup.procs", want: root + "/system.slice/nginx.service/cgroup.procs"},
+		{cgroup: "./system.slice//nginx.service/", want: root + "/system.slice/nginx.service/cgroup.procs"},
+		// ".." which stays under the root is allowed.
+		{cgroup: "system.slice/../user.slice", want: root + "/user.slice/cgroup.procs"},
+		{cgroup: root + "/system.slice/nginx.service", want: root + "/system.slice/nginx.service/cgroup.procs"},
+		{cgroup: root, want: root + "/cgroup.procs"},
+		{cgroup: ".", want: root + "/cgroup.procs"},
+	}
+	for _, tc := range testCases {
+		got, err := cgroupProcsPath(tc.cgroup)
+		if err != nil {
+			t.Errorf("%q: %s", tc.cgroup, err)
+		} else if got != tc.want {
+			t.Errorf("%q: got %q, want %q", tc.cgroup, got, tc.want)
+		}
+	}
+
+	for _, cgroup := range []string{
+		"..",
+		"../x",
+		"a/../../x",
+		"system.slice/../../../../etc",
+		"../0123abcd/system.slice",
+		"/sys/fs/cgroup/system.slice",
+		"/sys/fs/cgroup/docker/0123abcdef",
+		root + "/../x",
+		"/etc/passwd",
+	} {
+		if got, err := cgroupProcsPath(cgroup); err == nil {
+			t.Errorf("%q: got %q, want an error of a path out of the root", cgroup, got)
+		}
+	}
+}
+
+func TestGetPidsOfCgroupsUnderRoot(t *testing.T) {
+	setCgroupRoot(t, "/sys/fs/cgroup")
+	setFixtureRoot(t, map[string]string{
+		"/sys/fs/cgroup/user.slice/user-1000.slice/session-1.scope/cgroup.procs": "1200\n1201\n",
+		// A file out of the cgroup root which must not be read.
+		"/sys/fs/x/cgroup.procs": "1\n",
+	})
+	const cgroup = "user.slice/user-1000.slice/session-1.scope"
+	pids, err := getPidsOfCgroups([]string{cgroup})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []procfs.ServicePid{{Service: cgroup, Pid: 1200}, {Service: cgroup, Pid: 1201}}
+	if !slices.Equal(pids, want) {
+		t.Errorf("got %v, want %v", pids, want)
+	}
+
+	if pids, err := getPidsOfCgroups([]string{"../x"}); err == nil {
+		t.Errorf("got %v, want an error of a path out of the root", pids)
+	}
+}
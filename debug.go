@@ -0,0 +1,35 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// debugMode enables the debug fields of procfs.LookupDebugFieldDef. It is
+// set with the hidden --debug flag.
+var debugMode bool
+
+// writeDebugSysValues writes the system-wide values used to calculate
+// "start", "uptime", and "pcpu" from clock ticks.
+func writeDebugSysValues(w io.Writer, sysValCache *procfs.SysValueCache) {
+	fmt.Fprintf(w, "clock ticks:   %d/s\n", procfs.ClkTck())
+	if bootTime, err := sysValCache.GetBootTime(); err != nil {
+		fmt.Fprintf(w, "boot time:     %s\n", err)
+	} else {
+		fmt.Fprintf(w, "boot time:     %s (%d)\n", bootTime, bootTime.Unix())
+	}
+	if sysUptime, err := sysValCache.GetSystemUptime(); err != nil {
+		fmt.Fprintf(w, "system uptime: %s\n", err)
+	} else {
+		fmt.Fprintf(w, "system uptime: %s\n", sysUptime)
+	}
+	if idleTime, err := sysValCache.GetIdleTime(); err != nil {
+		fmt.Fprintf(w, "idle time:     %s\n", err)
+	} else {
+		fmt.Fprintf(w, "idle time:     %s\n", idleTime)
+	}
+}
@@ -0,0 +1,56 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"text/template"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// dedupeDataList collapses data with the same value of field into the
+// first one of them and sets the number of them to fieldCount.
+// If sum is true, numeric values except pid and ppid are summed up in
+// the collapsed data.
+func dedupeDataList(dataList []map[string]any, field string, sum bool) []map[string]any {
+	var deduped []map[string]any
+	indexes := make(map[string]int)
+	for _, data := range dataList {
+		key := fmt.Sprint(data[field])
+		i, ok := indexes[key]
+		if !ok {
+			indexes[key] = len(deduped)
+			data[fieldCount] = 1
+			deduped = append(deduped, data)
+			continue
+		}
+		group := deduped[i]
+		group[fieldCount] = group[fieldCount].(int) + 1
+		if sum {
+			sumNumericValues(group, data)
+		}
+	}
+	return deduped
+}
+
+// sumNumericValues adds numeric values in src to those in dst. Unlimited
+// bytes stay unlimited.
+func sumNumericValues(dst, src map[string]any) {
+	for key, value := range src {
+		switch value.(type) {
+		case uint64, procfs.Percent:
+			if dstValue, ok := dst[key]; ok {
+				dst[key] = addValues(dstValue, value)
+			}
+		}
+	}
+}
+
+func newCountColumn() Column {
+	return Column{
+		Field:    fieldCount,
+		Align:    AlignRight,
+		Template: template.Must(template.New("").Parse("{{." + fieldCount + "}}")),
+	}
+}
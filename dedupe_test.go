@@ -0,0 +1,37 @@
+//go:build linux
+
+package main
+
+import (
+	"maps"
+	"testing"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+func TestDedupeDataList(t *testing.T) {
+	newDataList := func() []map[string]any {
+		return []map[string]any{
+			{fieldPID: 1, fieldCommand: "nginx: master", fieldRSS: uint64(4096), fieldRSSLim: uint64(unlimitedBytes), fieldPCPU: procfs.Percent(0.5)},
+			{fieldPID: 2, fieldCommand: "nginx: worker", fieldRSS: uint64(8192), fieldRSSLim: uint64(5000), fieldPCPU: procfs.Percent(1)},
+			{fieldPID: 3, fieldCommand: "nginx: worker", fieldRSS: uint64(8192), fieldRSSLim: uint64(unlimitedBytes), fieldPCPU: procfs.Percent(2)},
+			{fieldPID: 4, fieldCommand: "nginx: worker", fieldRSS: uint64(1024), fieldPCPU: procfs.Percent(0.5)},
+		}
+	}
+
+	got := dedupeDataList(newDataList(), fieldCommand, false)
+	want := []map[string]any{
+		{fieldCount: 1, fieldPID: 1, fieldCommand: "nginx: master", fieldRSS: uint64(4096), fieldRSSLim: uint64(unlimitedBytes), fieldPCPU: procfs.Percent(0.5)},
+		{fieldCount: 3, fieldPID: 2, fieldCommand: "nginx: worker", fieldRSS: uint64(8192), fieldRSSLim: uint64(5000), fieldPCPU: procfs.Percent(1)},
+	}
+	if len(got) != len(want) || !maps.Equal(got[0], want[0]) || !maps.Equal(got[1], want[1]) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// pid is kept, and rsslim stays unlimited if any of them is unlimited.
+	got = dedupeDataList(newDataList(), fieldCommand, true)
+	want[1] = map[string]any{fieldCount: 3, fieldPID: 2, fieldCommand: "nginx: worker", fieldRSS: uint64(17408), fieldRSSLim: uint64(unlimitedBytes), fieldPCPU: procfs.Percent(3.5)}
+	if len(got) != len(want) || !maps.Equal(got[0], want[0]) || !maps.Equal(got[1], want[1]) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,43 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"syscall"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// writeTableToCommand runs command with "sh -c" and writes table to its
+// stdin in the same format as --output=ndjson, i.e. one JSON object per
+// row with formatted column values keyed by column names and the "service"
+// key. The stdout and stderr of the command are relayed to ours.
+func writeTableToCommand(ctx context.Context, command string, table *Table) error {
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return procfs.CommandError(cmd, err)
+	}
+	writeErr := ndjsonFormatter{}.WriteTable(stdin, table)
+	if err := stdin.Close(); err != nil && writeErr == nil {
+		writeErr = err
+	}
+	if err := cmd.Wait(); err != nil {
+		return procfs.CommandError(cmd, err)
+	}
+	// The command may exit successfully without reading all rows, e.g. "head -1".
+	if writeErr != nil && !errors.Is(writeErr, syscall.EPIPE) {
+		return fmt.Errorf("cannot write to %s: %s", cmd, writeErr)
+	}
+	return nil
+}
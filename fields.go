@@ -0,0 +1,144 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// countFieldDef is the field of the column added by --dedupe-by.
+// It is not in procfs since its value is computed by dedupeDataList.
+var countFieldDef = &procfs.FieldDef{
+	Name:  fieldCount,
+	Title: "COUNT",
+	Type:  "integer",
+}
+
+// rateFieldDefs are the fields of changes per second between ticks of
+// --interval. They are not in procfs since their values are computed by
+// applyRates from samples of the previous tick.
+var rateFieldDefs = []*procfs.FieldDef{
+	{
+		Name:       fieldCPURate,
+		Title:      "CPU_RATE",
+		Type:       procfs.FieldTypePercent,
+		Formatters: []string{"pct"},
+	},
+	{
+		Name:       fieldRSSRate,
+		Title:      "RSS_RATE",
+		Type:       fieldTypeBytesRate,
+		Formatters: []string{"iBytesRate"},
+	},
+}
+
+// fieldTypeBytesRate is the type of signed changes of bytes per second.
+const fieldTypeBytesRate = "bytes/s"
+
+// lookupFieldDef returns the definition of the field in procfs, including
+// fieldCount, rateFieldDefs, and debug fields with --debug.
+func lookupFieldDef(field string) (*procfs.FieldDef, bool) {
+	if field == fieldCount {
+		return countFieldDef, true
+	}
+	for _, def := range rateFieldDefs {
+		if def.Name == field {
+			return def, true
+		}
+	}
+	if def, ok := procfs.LookupFieldDef(field); ok {
+		return def, true
+	}
+	if debugMode {
+		return procfs.LookupDebugFieldDef(field)
+	}
+	return nil, false
+}
+
+// lookupFieldDefs returns the definitions of fields which are known.
+func lookupFieldDefs(fields []string) []*procfs.FieldDef {
+	defs := make([]*procfs.FieldDef, 0, len(fields))
+	for _, field := range fields {
+		if def, ok := lookupFieldDef(field); ok {
+			defs = append(defs, def)
+		}
+	}
+	return defs
+}
+
+// expandAllFields returns fields where fieldAll is replaced with all fields
+// except unavailable ones, e.g. "ismain" without systemctl.
+func expandAllFields(fields, unavailable []string) []string {
+	if !slices.Contains(fields, fieldAll) {
+		return fields
+	}
+	var expanded []string
+	for _, field := range fields {
+		if field != fieldAll {
+			expanded = append(expanded, field)
+			continue
+		}
+		for _, f := range allFieldNames() {
+			if !slices.Contains(unavailable, f) {
+				expanded = append(expanded, f)
+			}
+		}
+	}
+	return expanded
+}
+
+// allFieldNames returns the names of all fields in procfs and
+// rateFieldDefs.
+func allFieldNames() []string {
+	names := procfs.AllFieldNames()
+	for _, def := range rateFieldDefs {
+		names = append(names, def.Name)
+	}
+	return names
+}
+
+// fieldTitle returns the column title of the field.
+func fieldTitle(field string) string {
+	if def, ok := lookupFieldDef(field); ok {
+		return def.Title
+	}
+	return strings.ToUpper(field)
+}
+
+// fieldRef returns the template expression to refer the value of the field.
+// Fields like "env:NODE_ENV" are not valid identifiers, so "index" is used.
+func fieldRef(field string) string {
+	if strings.Contains(field, ":") {
+		return fmt.Sprintf("(index . %q)", field)
+	}
+	return "." + field
+}
+
+func invalidFieldError(field string) error {
+	var prefixes, paramNames []string
+	for _, p := range procfs.ParamFieldDefs() {
+		prefixes = append(prefixes, p.Prefix)
+		paramNames = append(paramNames, p.Name())
+	}
+	if prefix, _, ok := strings.Cut(field, ":"); ok && !slices.Contains(prefixes, prefix) {
+		return fmt.Errorf("invalid field: %s, unknown prefix %s, must be one of %s", field,
+			prefix, strings.Join(prefixes, ", "))
+	}
+	names := append(allFieldNames(), paramNames...)
+	return fmt.Errorf("invalid field: %s, must be one of %s, or %s", field,
+		strings.Join(names[:len(names)-1], ", "), names[len(names)-1])
+}
+
+// procReadOptions returns the options for reading /proc/<pid> files which
+// are needed to extract the fields.
+func procReadOptions(fields []string) procfs.ReadOptions {
+	return procfs.ReadOptionsOf(lookupFieldDefs(fields))
+}
+
+func convertProcessRawRecordsToDataList(sysValCache *procfs.SysValueCache, fields []string, records []procfs.ProcessRawRecord, opts procfs.ConvertOptions) ([]map[string]any, error) {
+	return procfs.Convert(sysValCache, lookupFieldDefs(fields), records, opts)
+}
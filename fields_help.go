@@ -0,0 +1,44 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// writeFieldsHelp writes a table of all fields with their titles,
+// alignments, value types, and formatting functions.
+func writeFieldsHelp(w io.Writer, alignments map[string]string, defaultAlign string) error {
+	rows := [][]string{{"COLUMN", "TITLE", "ALIGN", "TYPE", "FORMATS"}}
+	row := func(name, title, typ string, formatters []string) []string {
+		align, ok := alignments[name]
+		if !ok {
+			align = defaultAlign
+		}
+		joined := strings.Join(formatters, ",")
+		if joined == "" {
+			joined = "-"
+		}
+		return []string{name, title, align, typ, joined}
+	}
+	for _, def := range append(procfs.FieldDefs(), rateFieldDefs...) {
+		rows = append(rows, row(def.Name, def.Title, def.Type, def.Formatters))
+	}
+	for _, p := range procfs.ParamFieldDefs() {
+		rows = append(rows, row(p.Name(), p.Arg, p.Type, p.Formatters))
+	}
+	alignedRows, err := AlignColumns(rows, []Align{AlignLeft, AlignLeft, AlignLeft, AlignLeft, AlignLeft})
+	if err != nil {
+		return err
+	}
+	for _, row := range alignedRows {
+		if _, err := fmt.Fprintln(w, strings.Join(row, "  ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+func TestExpandAllFields(t *testing.T) {
+	all := allFieldNames()
+	withoutIsMain := slices.DeleteFunc(slices.Clone(all), func(f string) bool { return f == fieldIsMain })
+
+	testCases := []struct {
+		fields      []string
+		unavailable []string
+		want        []string
+	}{
+		{fields: []string{fieldPID, fieldRSS}, want: []string{fieldPID, fieldRSS}},
+		// Explicit fields are kept even if unavailable so that they are reported.
+		{fields: []string{fieldIsMain}, unavailable: []string{fieldIsMain}, want: []string{fieldIsMain}},
+		{fields: []string{fieldAll}, want: all},
+		{fields: []string{fieldAll}, unavailable: []string{fieldIsMain}, want: withoutIsMain},
+		{fields: []string{"env:HOME", fieldAll}, unavailable: []string{fieldIsMain},
+			want: append([]string{"env:HOME"}, withoutIsMain...)},
+	}
+	for _, tc := range testCases {
+		got := expandAllFields(tc.fields, tc.unavailable)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("expandAllFields(%q, %q) = %q, want %q", tc.fields, tc.unavailable, got, tc.want)
+		}
+	}
+}
+
+func TestContextSwitchColumns(t *testing.T) {
+	setFixtureRoot(t, map[string]string{
+		"/proc/1/stat":   fixtureStat,
+		"/proc/1/status": "Name:\tnode\nvoluntary_ctxt_switches:\t186\nnonvoluntary_ctxt_switches:\t52\n",
+	})
+	fields := []string{fieldVolCS, fieldNonVolCS}
+	for _, def := range lookupFieldDefs(fields) {
+		if def.Type != "integer" {
+			t.Errorf("%s: got type %q, want integer", def.Name, def.Type)
+		}
+	}
+	// Context switches are read from /proc/<pid>/status.
+	opts := procReadOptions(fields)
+	if !opts.Status {
+		t.Fatal("got no status in read options")
+	}
+	record, err := procfs.ReadProcess(context.Background(), 1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sysValCache := procfs.NewSysValueCache(context.Background())
+	dataList, err := convertProcessRawRecordsToDataList(sysValCache, fields, []procfs.ProcessRawRecord{record}, procfs.ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dataList[0], map[string]any{fieldVolCS: uint64(186), fieldNonVolCS: uint64(52)}; !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Numbers are right aligned by default.
+	columns, err := buildColumns(sysValCache, fields, nil, map[string]string{fieldCommand: alignLeft}, alignRight, time.UTC, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := renderRow(columns, dataList[0], 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, err := AlignColumns([][]string{convertColumnsToHeader(columns), row}, convertColumnsToAlign(columns))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(rows[1], " "), "  186       52"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestProcReadOptionsCmdline(t *testing.T) {
+	testCases := []struct {
+		fields []string
+		want   bool
+	}{
+		{fields: []string{fieldPID, fieldRSS}, want: false},
+		{fields: []string{fieldPID, fieldComm}, want: false},
+		{fields: []string{fieldPID, fieldCommand}, want: true},
+	}
+	for _, tc := range testCases {
+		if got := procReadOptions(tc.fields).Cmdline; got != tc.want {
+			t.Errorf("fields %q: got cmdline %v, want %v", tc.fields, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// FormatMap maps fields to formatting functions for the format flag.
+// Unlike kong's map flags, entries can be separated with either ';' or ','
+// so that it can be written in the same way as the column flag.
+// Separators in quoted template arguments or escaped with '\' are kept.
+type FormatMap map[string]string
+
+func (m *FormatMap) Decode(ctx *kong.DecodeContext) error {
+	var value string
+	if err := ctx.Scan.PopValueInto("format", &value); err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = make(FormatMap)
+	}
+	for _, entry := range splitFormatEntries(value) {
+		if entry == "" {
+			continue
+		}
+		field, funcCall, ok := strings.Cut(entry, "=")
+		if !ok {
+			return fmt.Errorf("invalid format entry: %q, must be \"<column>=<function>\" separated by ';' or ','", entry)
+		}
+		(*m)[field] = funcCall
+	}
+	return nil
+}
+
+// splitFormatEntries splits s by ';' and ',' which are neither in a quoted
+// string nor escaped with '\'.
+func splitFormatEntries(s string) []string {
+	var entries []string
+	var b strings.Builder
+	var quote rune
+	escaped := false
+	for _, r := range s {
+		switch {
+		case escaped:
+			if r != ';' && r != ',' {
+				b.WriteRune('\\')
+			}
+			b.WriteRune(r)
+			escaped = false
+		case quote != 0:
+			if r == '\\' && quote == '"' {
+				escaped = true
+				continue
+			}
+			if r == quote {
+				quote = 0
+			}
+			b.WriteRune(r)
+		case r == '\\':
+			escaped = true
+		case r == '"' || r == '`':
+			quote = r
+			b.WriteRune(r)
+		case r == ';' || r == ',':
+			entries = append(entries, b.String())
+			b.Reset()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	if escaped {
+		b.WriteRune('\\')
+	}
+	return append(entries, b.String())
+}
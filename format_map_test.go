@@ -0,0 +1,30 @@
+//go:build linux
+
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSplitFormatEntries(t *testing.T) {
+	testCases := []struct {
+		s    string
+		want []string
+	}{
+		{s: "rss=iBytes", want: []string{"rss=iBytes"}},
+		{s: "rss=iBytes;vsz=iBytes,uptime=duration", want: []string{"rss=iBytes", "vsz=iBytes", "uptime=duration"}},
+		{s: "rss=iBytes,vsz=iBytes;", want: []string{"rss=iBytes", "vsz=iBytes", ""}},
+		// Separators in quoted strings are kept.
+		{s: `start=format "Jan 2, 15:04";rss=iBytes,vsz=iBytes`, want: []string{`start=format "Jan 2, 15:04"`, "rss=iBytes", "vsz=iBytes"}},
+		{s: "start=format `15:04;05`,rss=iBytes", want: []string{"start=format `15:04;05`", "rss=iBytes"}},
+		// Escaped separators are kept without '\'.
+		{s: `start=format 15:04\,05;rss=iBytes`, want: []string{"start=format 15:04,05", "rss=iBytes"}},
+		{s: `start=format "a\"b";rss=iBytes`, want: []string{`start=format "a\"b"`, "rss=iBytes"}},
+	}
+	for _, tc := range testCases {
+		if got := splitFormatEntries(tc.s); !slices.Equal(got, tc.want) {
+			t.Errorf("splitFormatEntries(%q) = %q, want %q", tc.s, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,264 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"os/signal"
+	"slices"
+	"syscall"
+	"time"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// runEveryInterval runs c.run every --interval to stream ndjson records
+// with the "ts" key until interrupted or the context is done, e.g. by
+// --timeout. It aborts on an error of flags, and warns other errors like
+// a service which is restarting to try again on the next tick.
+func (c *CLI) runEveryInterval(ctx context.Context) error {
+	if c.Output != outputNDJSON && c.Exec == "" && !c.WatchDiff {
+		return errors.New("flag --interval is supported only for --output=ndjson, --exec, or --watch-diff")
+	}
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	ticker := time.NewTicker(c.Interval)
+	defer ticker.Stop()
+	for {
+		if err := c.run(ctx); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if !c.flagsValidated {
+				return err
+			}
+			slog.Warn("cannot read processes, retrying on the next tick", "err", err)
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// sampleKey identifies a process across ticks of --interval. The start time
+// distinguishes a process which reuses the pid of an exited one.
+type sampleKey struct {
+	pid       int
+	startTime string
+}
+
+// processSample is values of a process read on a tick of --interval to
+// calculate changes until the next tick.
+type processSample struct {
+	time time.Time
+	// cpuTicks is the sum of utime and stime in clock ticks.
+	cpuTicks uint64
+	// cpuOK is false if utime or stime cannot be read.
+	cpuOK bool
+	// rssBytes is the rss in bytes.
+	rssBytes uint64
+	// rssOK is false if rss cannot be read or is not needed.
+	rssOK bool
+	// data is the values of the process with --watch-diff.
+	data map[string]any
+}
+
+// processSamples is samples of processes keyed by sampleKey.
+type processSamples map[sampleKey]processSample
+
+func newSampleKey(record *procfs.ProcessRawRecord) sampleKey {
+	return sampleKey{pid: record.Pid, startTime: record.StartTime.String()}
+}
+
+// newProcessSamples returns samples of records read at readTime. pageSize
+// is used to convert rss in pages to bytes, and rss is not sampled if it
+// is zero.
+func newProcessSamples(records []procfs.ProcessRawRecord, readTime time.Time, pageSize int) processSamples {
+	samples := make(processSamples, len(records))
+	for i := range records {
+		record := &records[i]
+		sample := processSample{time: readTime}
+		uTime, err := record.UTime.AsTicks()
+		if err == nil {
+			var sTime uint64
+			if sTime, err = record.STime.AsTicks(); err == nil {
+				sample.cpuTicks, sample.cpuOK = uTime+sTime, true
+			}
+		}
+		if pageSize > 0 {
+			if rssBytes, err := record.RSS.InBytes(pageSize); err == nil {
+				sample.rssBytes, sample.rssOK = rssBytes, true
+			}
+		}
+		samples[newSampleKey(record)] = sample
+	}
+	return samples
+}
+
+// deltaCPU returns the CPU usage in percent of the process between prev and
+// cur, or false if it cannot be calculated.
+func deltaCPU(prev, cur processSample) (procfs.Percent, bool) {
+	elapsed := cur.time.Sub(prev.time)
+	if !prev.cpuOK || !cur.cpuOK || cur.cpuTicks < prev.cpuTicks || elapsed <= 0 {
+		return 0, false
+	}
+	cpuTime, err := procfs.TicksToDuration(cur.cpuTicks - prev.cpuTicks)
+	if err != nil {
+		return 0, false
+	}
+	return procfs.Percent(float64(cpuTime) / float64(elapsed) * 100), true
+}
+
+// deltaRSS returns the change of rss in bytes per second of the process
+// between prev and cur, which is negative if rss decreased, or false if it
+// cannot be calculated.
+func deltaRSS(prev, cur processSample) (int, bool) {
+	elapsed := cur.time.Sub(prev.time)
+	if !prev.rssOK || !cur.rssOK || elapsed <= 0 {
+		return 0, false
+	}
+	delta := float64(cur.rssBytes) - float64(prev.rssBytes)
+	return int(math.Round(delta / elapsed.Seconds())), true
+}
+
+// applyDeltaCPU replaces "pcpu" in dataList converted from records with the
+// CPU usage since the previous tick like top, since the lifetime average is
+// hardly changed between ticks for long running processes. Processes
+// without previous samples, e.g. on the first tick, keep the lifetime
+// average.
+func applyDeltaCPU(dataList []map[string]any, records []procfs.ProcessRawRecord, samples, prevSamples processSamples) {
+	for i, data := range dataList {
+		if _, ok := data[fieldPCPU]; !ok {
+			continue
+		}
+		key := newSampleKey(&records[i])
+		prev, ok := prevSamples[key]
+		if !ok {
+			continue
+		}
+		if pcpu, ok := deltaCPU(prev, samples[key]); ok {
+			data[fieldPCPU] = pcpu
+		}
+	}
+}
+
+// applyRates sets "cpu_rate" and "rss_rate" in dataList converted from
+// records to changes per second since the previous tick if they are in
+// fields. They are missing for processes without previous samples, e.g. on
+// the first tick, unlike "pcpu".
+func applyRates(dataList []map[string]any, records []procfs.ProcessRawRecord, fields []string, samples, prevSamples processSamples) {
+	cpuRate := slices.Contains(fields, fieldCPURate)
+	rssRate := slices.Contains(fields, fieldRSSRate)
+	if !cpuRate && !rssRate {
+		return
+	}
+	for i, data := range dataList {
+		key := newSampleKey(&records[i])
+		prev, ok := prevSamples[key]
+		if !ok {
+			continue
+		}
+		cur := samples[key]
+		if cpuRate {
+			if rate, ok := deltaCPU(prev, cur); ok {
+				data[fieldCPURate] = rate
+			}
+		}
+		if rssRate {
+			if rate, ok := deltaRSS(prev, cur); ok {
+				data[fieldRSSRate] = rate
+			}
+		}
+	}
+}
+
+// dataKeySampleKey is the key in data for sampleKey of the process with
+// --watch-diff, which is used to find the data on the previous tick.
+const dataKeySampleKey = "sampleKey"
+
+// setSampleData sets dataList converted from records to samples, and
+// sampleKey to each data, to compare values on the next tick.
+func setSampleData(dataList []map[string]any, records []procfs.ProcessRawRecord, samples processSamples) {
+	for i, data := range dataList {
+		key := newSampleKey(&records[i])
+		data[dataKeySampleKey] = key
+		sample := samples[key]
+		sample.data = data
+		samples[key] = sample
+	}
+}
+
+// cellChange is the change of the value of a cell since the previous tick.
+type cellChange int
+
+const (
+	cellUnchanged cellChange = iota
+	cellIncreased
+	cellDecreased
+	// cellChanged is a change of a value which is not a number.
+	cellChanged
+)
+
+// cellChangesOfDataList returns changes of values of columns for each data
+// since the data of the same process in prevSamples. Changes are nil for
+// data of new processes and aggregated data.
+func cellChangesOfDataList(columns []Column, dataList []map[string]any, prevSamples processSamples) [][]cellChange {
+	changes := make([][]cellChange, len(dataList))
+	for i, data := range dataList {
+		key, ok := data[dataKeySampleKey].(sampleKey)
+		if !ok {
+			continue
+		}
+		prev := prevSamples[key].data
+		if prev == nil {
+			continue
+		}
+		changes[i] = make([]cellChange, len(columns))
+		for j, column := range columns {
+			changes[i][j] = valueChange(column.Field, data[column.Field], prev[column.Field])
+		}
+	}
+	return changes
+}
+
+// valueChange returns the change from prev to cur of the value of field.
+func valueChange(field string, cur, prev any) cellChange {
+	if cur == nil || prev == nil {
+		if (cur == nil) != (prev == nil) {
+			return cellChanged
+		}
+		return cellUnchanged
+	}
+	if def, ok := lookupFieldDef(field); ok && isNumericField(def) {
+		switch c := compareValues(cur, prev); {
+		case c > 0:
+			return cellIncreased
+		case c < 0:
+			return cellDecreased
+		default:
+			return cellUnchanged
+		}
+	}
+	if fmt.Sprint(cur) != fmt.Sprint(prev) {
+		return cellChanged
+	}
+	return cellUnchanged
+}
+
+// useColor reports whether stdout is a terminal and NO_COLOR is not set.
+// https://no-color.org/
+func useColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	fi, err := os.Stdout.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
@@ -0,0 +1,209 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// readFixtureRecord returns the record of pid 1 read from the content of
+// /proc/1/stat, and rss from the content of /proc/1/statm if it is not empty.
+func readFixtureRecord(t *testing.T, stat, statm string) procfs.ProcessRawRecord {
+	t.Helper()
+	files := map[string]string{"/proc/1/stat": stat}
+	var opts procfs.ReadOptions
+	if statm != "" {
+		files["/proc/1/statm"] = statm
+		opts.RSSSource = procfs.RSSSourceStatm
+	}
+	setFixtureRoot(t, files)
+	record, err := procfs.ReadProcess(context.Background(), 1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return record
+}
+
+// fixtureStatOf returns the content of /proc/1/stat with utime and stime in
+// clock ticks of the process which started at starttime.
+func fixtureStatOf(utime, stime, starttime string) string {
+	return "1 (node) S 0 0 0 0 -1 4194560 0 0 0 0 " + utime + " " + stime +
+		" 0 0 20 0 1 0 " + starttime + " 24072192 2239 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 0 0 0\n"
+}
+
+// fixtureStatmOf returns the content of /proc/1/statm with rss in pages.
+func fixtureStatmOf(rss string) string {
+	return "5877 " + rss + " 1072 1 0 3127 0\n"
+}
+
+func TestApplyDeltaCPU(t *testing.T) {
+	t0 := time.Unix(1792164453, 0)
+	// The process used 2 seconds of CPU time in 500 ticks at 100Hz.
+	prevRecords := []procfs.ProcessRawRecord{readFixtureRecord(t, fixtureStatOf("300", "200", "700"), "")}
+	prevSamples := newProcessSamples(prevRecords, t0, 0)
+
+	testCases := []struct {
+		name      string
+		record    procfs.ProcessRawRecord
+		prev      processSamples
+		lifetime  procfs.Percent
+		wantDelta procfs.Percent
+	}{
+		// 1.5 seconds of CPU time in 5 seconds.
+		{name: "delta", record: readFixtureRecord(t, fixtureStatOf("400", "250", "700"), ""), prev: prevSamples, wantDelta: 30},
+		{name: "first tick", record: readFixtureRecord(t, fixtureStatOf("400", "250", "700"), ""), lifetime: 12.5, wantDelta: 12.5},
+		// A new process reuses the pid with another start time.
+		{name: "reused pid", record: readFixtureRecord(t, fixtureStatOf("1", "0", "900"), ""), prev: prevSamples, lifetime: 0.5, wantDelta: 0.5},
+	}
+	for _, tc := range testCases {
+		records := []procfs.ProcessRawRecord{tc.record}
+		dataList := []map[string]any{{fieldPID: 1, fieldPCPU: tc.lifetime}}
+		applyDeltaCPU(dataList, records, newProcessSamples(records, t0.Add(5*time.Second), 0), tc.prev)
+		if got := dataList[0][fieldPCPU]; got != tc.wantDelta {
+			t.Errorf("%s: got %v, want %v", tc.name, got, tc.wantDelta)
+		}
+	}
+}
+
+func TestApplyDeltaCPUWithoutPCPU(t *testing.T) {
+	t0 := time.Unix(1792164453, 0)
+	prevSamples := newProcessSamples([]procfs.ProcessRawRecord{readFixtureRecord(t, fixtureStatOf("300", "200", "700"), "")}, t0, 0)
+	records := []procfs.ProcessRawRecord{readFixtureRecord(t, fixtureStatOf("400", "250", "700"), "")}
+	dataList := []map[string]any{{fieldPID: 1}}
+	applyDeltaCPU(dataList, records, newProcessSamples(records, t0.Add(time.Second), 0), prevSamples)
+	if got, ok := dataList[0][fieldPCPU]; ok {
+		t.Errorf("got %v, want no pcpu", got)
+	}
+}
+
+func TestApplyRates(t *testing.T) {
+	const pageSize = 4096
+	t0 := time.Unix(1792164453, 0)
+	fields := []string{fieldCPURate, fieldRSSRate}
+	prevSamples := newProcessSamples([]procfs.ProcessRawRecord{readFixtureRecord(t, fixtureStatOf("100", "0", "700"), fixtureStatmOf("1000"))}, t0, pageSize)
+
+	testCases := []struct {
+		name        string
+		utime, rss  string
+		prev        processSamples
+		wantCPURate any
+		wantRSSRate any
+	}{
+		// 1 second of CPU time and 1024 pages in 4 seconds.
+		{name: "growing", utime: "200", rss: "2024", prev: prevSamples, wantCPURate: procfs.Percent(25), wantRSSRate: 1024 * pageSize / 4},
+		{name: "shrinking", utime: "100", rss: "0", prev: prevSamples, wantCPURate: procfs.Percent(0), wantRSSRate: -1000 * pageSize / 4},
+		{name: "first tick", utime: "200", rss: "2024"},
+	}
+	for _, tc := range testCases {
+		records := []procfs.ProcessRawRecord{readFixtureRecord(t, fixtureStatOf(tc.utime, "0", "700"), fixtureStatmOf(tc.rss))}
+		dataList := []map[string]any{{fieldPID: 1}}
+		applyRates(dataList, records, fields, newProcessSamples(records, t0.Add(4*time.Second), pageSize), tc.prev)
+		if got := dataList[0][fieldCPURate]; got != tc.wantCPURate {
+			t.Errorf("%s: cpu_rate got %v, want %v", tc.name, got, tc.wantCPURate)
+		}
+		if got := dataList[0][fieldRSSRate]; got != tc.wantRSSRate {
+			t.Errorf("%s: rss_rate got %v, want %v", tc.name, got, tc.wantRSSRate)
+		}
+	}
+}
+
+func TestApplyRatesOnlyForFields(t *testing.T) {
+	t0 := time.Unix(1792164453, 0)
+	prevSamples := newProcessSamples([]procfs.ProcessRawRecord{readFixtureRecord(t, fixtureStatOf("100", "0", "700"), fixtureStatmOf("1000"))}, t0, 4096)
+	records := []procfs.ProcessRawRecord{readFixtureRecord(t, fixtureStatOf("200", "0", "700"), fixtureStatmOf("2000"))}
+	dataList := []map[string]any{{fieldPID: 1}}
+	applyRates(dataList, records, []string{fieldPID, fieldRSSRate}, newProcessSamples(records, t0.Add(time.Second), 4096), prevSamples)
+	if got, ok := dataList[0][fieldCPURate]; ok {
+		t.Errorf("got cpu_rate %v, want none", got)
+	}
+	if _, ok := dataList[0][fieldRSSRate]; !ok {
+		t.Error("got no rss_rate")
+	}
+}
+
+func TestIBytesRate(t *testing.T) {
+	testCases := []struct {
+		b    int
+		want string
+	}{
+		{b: 0, want: "0 B/s"},
+		{b: 1536 * 1024, want: "1.5 MiB/s"},
+		{b: -1536 * 1024, want: "-1.5 MiB/s"},
+	}
+	for _, tc := range testCases {
+		if got := iBytesRate(tc.b); got != tc.want {
+			t.Errorf("iBytesRate(%d) = %q, want %q", tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestRunEveryIntervalExitsOnFlagErrors(t *testing.T) {
+	root := t.TempDir()
+	t.Cleanup(func() { procfs.SetRootDir("") })
+	testCases := []struct {
+		args []string
+		want string
+	}{
+		{args: []string{"--cgroup", "system.slice/nginx.service", "-c", "pid,ismain"}, want: "column ismain cannot be used with --cgroup"},
+		{args: []string{"-s", "nginx", "-c", "pid,command", "-f", "command=argv 0"}, want: "argv takes a positive number"},
+		{args: []string{"-s", "nginx", "-c", "pid,rss", "-f", `rss=iBytesUnit "XiB"`}, want: "invalid unit for iBytesUnit"},
+	}
+	for _, tc := range testCases {
+		args := append([]string{"--root", root, "--interval", "10ms", "-o", "ndjson"}, tc.args...)
+		cli := parseTestCLI(t, args...)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := cli.runEveryInterval(ctx)
+		if ctx.Err() != nil {
+			t.Errorf("%q: got no exit until the timeout", tc.args)
+		} else if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got %v, want an error with %q", tc.args, err, tc.want)
+		}
+		cancel()
+	}
+}
+
+func TestCellChangesOfDataList(t *testing.T) {
+	columns := []Column{{Field: fieldPID}, {Field: fieldRSS}, {Field: fieldPCPU}, {Field: fieldUser}, {Field: fieldTasks}}
+	prevKey := sampleKey{pid: 1, startTime: "700"}
+	prevSamples := processSamples{
+		prevKey: {data: map[string]any{
+			fieldPID: 1, fieldRSS: uint64(4096), fieldPCPU: procfs.Percent(2), fieldUser: "root", fieldTasks: "3/100",
+		}},
+	}
+	dataList := []map[string]any{
+		{dataKeySampleKey: prevKey, fieldPID: 1, fieldRSS: uint64(8192), fieldPCPU: procfs.Percent(1), fieldUser: "www-data"},
+		// A new process has no previous values.
+		{dataKeySampleKey: sampleKey{pid: 2, startTime: "900"}, fieldPID: 2, fieldRSS: uint64(4096)},
+		// Aggregated data has no process.
+		{fieldRSS: uint64(4096)},
+	}
+	got := cellChangesOfDataList(columns, dataList, prevSamples)
+	want := [][]cellChange{
+		{cellUnchanged, cellIncreased, cellDecreased, cellChanged, cellChanged},
+		nil,
+		nil,
+	}
+	if !slices.EqualFunc(got, want, slices.Equal) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSetSampleData(t *testing.T) {
+	records := []procfs.ProcessRawRecord{readFixtureRecord(t, fixtureStatOf("300", "200", "700"), "")}
+	samples := newProcessSamples(records, time.Unix(1792164453, 0), 0)
+	dataList := []map[string]any{{fieldPID: 1}}
+	setSampleData(dataList, records, samples)
+	key := newSampleKey(&records[0])
+	if got := dataList[0][dataKeySampleKey]; got != key {
+		t.Errorf("got key %v, want %v", got, key)
+	}
+	if got := samples[key]; got.data[fieldPID] != 1 || !got.cpuOK {
+		t.Errorf("got sample %+v, want the data and cpu ticks", got)
+	}
+}
@@ -1,23 +1,35 @@
+//go:build linux
+
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"html/template"
+	"io"
 	"io/fs"
+	"log/slog"
+	"math"
 	"os"
 	"os/exec"
+	"path"
+	"regexp"
+	"runtime"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
+	"text/template"
+	"text/template/parse"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/dustin/go-humanize"
+	"github.com/hnakamur/sdps/procfs"
 )
 
 const cliName = `sdps`
@@ -47,34 +59,166 @@ It's not a full replacement for "ps", but rather focuses on a core subset of fun
 `
 
 var cliVars = kong.Vars{
+	"state_help": `Filter processes by their state characters like "R" (running), "S" (sleeping), ` +
+		`"D" (uninterruptible disk sleep), "Z" (zombie), "T" (stopped), or "I" (idle), e.g. "--state=R,D".`,
+	"cgroup_help": `Specify cgroup path(s) instead of services to target arbitrary cgroups like a user session scope or a container, ` +
+		`e.g. "user.slice/user-1000.slice/session-1.scope" relative to --cgroup-root, or an absolute path under it ` +
+		`with or without "/cgroup.procs". The path is shown in place of the service name. ` +
+		`--main-pid and --ppid-filter=main are not supported since systemctl is not used.`,
+	"cgroup_root_help": `Directory of the cgroup hierarchy which contains "system.slice" of services, ` +
+		`and which --cgroup paths are relative to. Defaults to the parent of the cgroup of PID 1 under /sys/fs/cgroup ` +
+		`if PID 1 is in "init.scope", e.g. "/sys/fs/cgroup/docker/<id>" for systemd in a container ` +
+		`without a cgroup namespace, or /sys/fs/cgroup otherwise. Set this if services are not found in a container.`,
 	"column_default": `pid,ppid,pcpu,vsz,rss,start,uptime,command`,
 	"column_help": `Columns to display in the output. Available columns: ` +
-		`"pid", "ppid", "pcpu", "vsz", "rss", "start", "uptime", and "command".`,
-	"format_default": `vsz=iBytes;rss=iBytes;start=format "2006-01-02 15:04";uptime=duration`,
+		`"pid", "ppid", "pcpu", "pmem", "vsz", "rss", "vsz_peak", "rss_peak", "rsslim", "volcs", "nonvolcs", "cpu", "rtprio", "policy", "start", "uptime", "command", "comm", "user", "group", "listen", "ismain", "host", "bootid", "tasks", "cpu_rate", and "rss_rate". ` +
+		`"env:<name>" shows the environment variable <name> of processes, e.g. "env:NODE_ENV", and ` +
+		`"smaps:<key>" shows the value in bytes of <key> in /proc/<pid>/smaps_rollup, e.g. "smaps:Pss". ` +
+		`"user" and "group" show the effective user and group names, or the uid and gid if they cannot be resolved. ` +
+		`"listen" shows listening TCP and UDP addresses like "0.0.0.0:80/tcp" in the network namespace of sdps, ` +
+		`which requires privileges to read fds of processes of other users. ` +
+		`"comm" shows the command name truncated to 15 characters in /proc/<pid>/stat. ` +
+		`"rtprio" shows the real-time priority, which is 0 for non-real-time processes, and ` +
+		`"policy" shows the scheduling policy like the "cls" column of ps, i.e. ` +
+		`"TS" (SCHED_OTHER), "FF" (SCHED_FIFO), "RR" (SCHED_RR), "B" (SCHED_BATCH), "IDL" (SCHED_IDLE), or "DLN" (SCHED_DEADLINE). ` +
+		`"host" and "bootid" show the host name and the boot id in /proc/sys/kernel of the system ` +
+		`to identify rows collected from many hosts. ` +
+		`"tasks" shows pids.current and pids.max of the cgroup of the service like "12/4915", ` +
+		`which are same for processes in the service. ` +
+		`"ismain" shows whether the process is the main process of its service (MainPID of systemctl show). ` +
+		`"cpu_rate" and "rss_rate" show the CPU usage in percent and the change of "rss" per second ` +
+		`since the previous tick of --interval, which are missing on the first tick. ` +
+		`Columns are separated by "," or spaces, e.g. "pid rss command". ` +
+		`"all" expands to all columns except unavailable ones, i.e. "ismain" with --cgroup or without systemctl, and "cpu_rate" and "rss_rate" without --interval. Values which cannot be read are shown as "-".`,
+	"preset_help": `Set columns and formats for a common task. "ps" shows columns like "ps aux", ` +
+		`"mem" shows memory columns, and "cpu" shows CPU columns. ` +
+		`--column and --format override the preset, and formats same as the defaults are replaced with the preset's.`,
+	"format_default": `vsz=iBytes;rss=iBytes;vsz_peak=iBytes;rss_peak=iBytes;rsslim=iBytes;rss_rate=iBytesRate;start=format "2006-01-02 15:04";uptime=duration`,
 	"format_help": `Specify formatting functions for column values. Uses Go's text/template syntax after "|". ` +
-		`Available functions: "iBytes" for "vsz" and "rss", "format" or "humanRelTime" for "start", ` +
-		`"duration" or "seconds" for "uptime". ` +
+		`Available functions: "iBytes" for "vsz", "rss", "vsz_peak", "rss_peak", and "rsslim", "pct" for "pcpu", "pmem", and "cpu_rate", "iBytesRate" for "rss_rate", ` +
+		`"format", "humanRelTime", or "epoch" for "start", ` +
+		`"duration" or "seconds" for "uptime", and "argv" for "command". ` +
+		`"argv" takes the number of arguments to show, e.g. "argv 2" for the program and its first argument. ` +
+		`"pct" takes the number of digits after the decimal point, e.g. "pct 2". ` +
+		`"iBytesUnit" shows bytes in a fixed unit ("B", "KiB", "MiB", "GiB", "TiB", or "PiB") ` +
+		`with optional digits after the decimal point (default 1), e.g. 'iBytesUnit "MiB"' or 'iBytesUnit "GiB" 2'. ` +
 		`For "duration" units: "y" = 365.25 days, "M" = 30.4375 days, "d" = 24 hours. ` +
+		`An empty function like "rss=" shows the raw value. ` +
+		`Entries are separated by ";" or ",", e.g. "rss=iBytes,vsz=iBytes". ` +
+		`"start" has sub-second precision of clock ticks, which is shown with a layout like ` +
+		`'format "2006-01-02 15:04:05.00"' or with "epoch" as seconds since the Epoch. ` +
 		`For "format" layout details, see https://pkg.go.dev/time@latest#Layout.`,
 	"align_help":         `Override default column alignments. L (Left) or R (right).`,
 	"default_align_help": `Set the default alignment for all columns. L (Left) or R (right).`,
-	"agg_help": `Aggregate a single column value from processes. Currently, only ` +
-		`"--column=uptime --agg=min" is supported.`,
+	"rss_source_help": `Source of the "rss" column value. "stat" for /proc/<pid>/stat (fast but inaccurate), ` +
+		`"statm" for /proc/<pid>/statm, or "smaps" for /proc/<pid>/smaps_rollup (accurate but slower).`,
+	"output_help": `Output format. "table", "json", "ndjson", "csv", or "markdown". "json" outputs an array of objects ` +
+		`with formatted column values, or an object of build information with --version. ` +
+		`"ndjson" outputs one object per line with the "service" key added. ` +
+		`"markdown" outputs a GitHub-flavored markdown table, which always has the header to be valid.`,
+	"exec_help": `Run the command with "sh -c", write rows to its stdin in the same format as "--output=ndjson", ` +
+		`and show its output in place of the formatted output, e.g. "--exec='jq -r .pid'". ` +
+		`--output and --header are ignored.`,
+	"typed_help": `Write typed values instead of formatted ones in json and ndjson output, ` +
+		`which are kept formatted as in the table by default for compatibility, ` +
+		`e.g. bytes for "rss", nanoseconds for "uptime", and RFC 3339 time for "start". ` +
+		`"env:<name>" and "smaps:<key>" are written in the "env" and "smaps" objects, and "listen" as an array. ` +
+		`--format is ignored.`,
+	"where_help": `Select only processes matching the expression like 'rss > 100MiB && pcpu < 10'. ` +
+		`Numeric columns are compared with <, <=, >, >=, ==, or != to values same as --min, ` +
+		`and other columns like "command" are compared with == or != to double-quoted strings. ` +
+		`Comparisons can be combined with &&, ||, !, and parentheses.`,
+	"id_kind_help": `Kind of ids for the "user" and "group" columns. "real" is the id of the owner, ` +
+		`"effective" (same as ps) is the one used for permission checks, "saved" is the saved set id ` +
+		`which the process can switch back to, and "fs" is the one used for filesystem access. ` +
+		`See the Uid and Gid lines in proc_pid_status(5).`,
+	"uptime_resolution_help": `Truncate "uptime" to nanoseconds ("ns", i.e. no truncation), seconds ("s"), ` +
+		`minutes ("m"), or hours ("h"). This is applied before formatting, so for example ` +
+		`"--uptime-resolution=m" with "uptime=seconds" shows multiples of 60.`,
+	"sort_help": `Sort processes by columns, which is "pid" by default. Prefix a column with "-" for descending order. ` +
+		`Values are compared before formatting, e.g. "start" is sorted by the exact start time ` +
+		`even if the format shows only minutes, and strings like "command" are compared in natural order, ` +
+		`e.g. "worker2" comes before "worker10".`,
+	"agg_help": `Aggregate a single column value from processes. ` +
+		`"--column=uptime --agg=min" selects the youngest process ` +
+		`and the one with the smallest pid among processes with the same uptime. ` +
+		`"--agg=count" shows the number of processes, which is 0 if none, regardless of columns. ` +
+		`Values like "rss:sum,pcpu:max" show a single row with each column aggregated by "min", "max", or "sum" ` +
+		`for numeric columns. Every column must have one, and missing values are ignored.`,
 }
 
 var cli CLI
 
 type CLI struct {
-	Service []string `group:"process" short:"s" required:"" xor:"entry" help:"Specify systemd service name(s)."`
-	Filter  string   `group:"process" short:"l" help:"Filter processes by their command line."`
-
-	Column       []string          `group:"output" short:"c" default:"${column_default}" env:"SDPS_COLUMN" help:"${column_help}"`
-	Format       map[string]string `group:"output" short:"f" default:"${format_default}" env:"SDPS_FORMAT" help:"${format_help}"`
-	DefaultAlign string            `group:"output" short:"d" default:"R" env:"SDPS_DEFAULT_ALIGN" help:"${default_align_help}"`
-	Align        map[string]string `group:"output" short:"a" default:"command=L" env:"SDPS_ALIGN" help:"${align_help}"`
-	Agg          string            `group:"output" short:"g" help:"${agg_help}"`
-	Header       bool              `group:"output" default:"true" negatable:"" help:"Control whether to show the header row."`
-	Version      bool              `required:"" xor:"entry" help:"Show version and exit."`
+	Service           []string          `group:"process" short:"s" required:"" xor:"entry" help:"Specify systemd service name(s)."`
+	Cgroup            []string          `group:"process" required:"" xor:"entry" placeholder:"PATH" help:"${cgroup_help}"`
+	Filter            string            `group:"process" short:"l" help:"Filter processes by their command line."`
+	State             []string          `group:"process" help:"${state_help}"`
+	MainPID           bool              `group:"process" name:"main-pid" help:"Select only the main process of each service (MainPID of systemctl show)."`
+	ShowKernelThreads bool              `group:"process" help:"Include kernel threads, which are excluded by default. Processes are treated as kernel threads if PF_KTHREAD is set in the flags in /proc/<pid>/stat."`
+	ShowErrors        bool              `group:"process" help:"Show pids of processes skipped since they exited during the run or could not be read without privileges, and the reasons to stderr after output. By default, only the number of them is warned."`
+	PPidFilter        string            `group:"process" name:"ppid-filter" placeholder:"PID" help:"Select only child processes of this PID, e.g. workers of a master process. \"main\" selects children of the main process of each service."`
+	Younger           LongDuration      `group:"process" placeholder:"DURATION" help:"Select only processes whose uptime is shorter than this duration, e.g. \"5m\" to find recently restarted ones. Units \"y\", \"M\", \"w\", and \"d\" are accepted in addition to Go's duration units, e.g. \"1d12h\"."`
+	Older             LongDuration      `group:"process" placeholder:"DURATION" help:"Select only processes whose uptime is longer than this duration, e.g. \"7d\" to find stale ones. Units are same as --younger."`
+	Min               map[string]string `group:"process" help:"Select only processes whose values of numeric columns are at least the thresholds, e.g. \"rss=100MiB\". Sizes like \"1.5GB\" are accepted for byte columns and durations like \"1d12h\" for \"uptime\"."`
+	Max               map[string]string `group:"process" help:"Select only processes whose values of numeric columns are at most the thresholds, e.g. \"pcpu=50\". Values are same as --min."`
+	CgroupRoot        string            `group:"process" placeholder:"DIR" help:"${cgroup_root_help}"`
+	Where             string            `group:"process" placeholder:"EXPR" help:"${where_help}"`
+
+	Column                []string          `group:"output" short:"c" default:"${column_default}" env:"SDPS_COLUMN" help:"${column_help}"`
+	Preset                string            `group:"output" placeholder:"NAME" help:"${preset_help}"`
+	Format                FormatMap         `group:"output" short:"f" default:"${format_default}" env:"SDPS_FORMAT" help:"${format_help}"`
+	DefaultAlign          string            `group:"output" short:"d" default:"R" env:"SDPS_DEFAULT_ALIGN" help:"${default_align_help}"`
+	Align                 map[string]string `group:"output" short:"a" default:"command=L;comm=L;policy=L;user=L;group=L;host=L;bootid=L" env:"SDPS_ALIGN" help:"${align_help}"`
+	AlignNumbersByDecimal bool              `group:"output" help:"Align numbers of percent columns like \"pcpu\" and \"pmem\" on the decimal point when they have different digits after it, e.g. with \"pcpu=pct 2\" and values like \"12.5\"."`
+	GroupByService        bool              `group:"output" help:"Show a section with the header for each service or cgroup separated by a blank line. Supported only for --output=table."`
+	Border                bool              `group:"output" help:"Draw borders around cells with box-drawing characters. Supported only for --output=table."`
+	DedupeBy              string            `group:"output" help:"Collapse processes with the same value of the column like \"command\" into one row with the \"count\" column prepended."`
+	DedupeSum             bool              `group:"output" help:"Sum up numeric values like \"rss\" of collapsed processes with --dedupe-by instead of showing the first one's."`
+	Sort                  []string          `group:"output" help:"${sort_help}"`
+	NoSort                bool              `group:"output" help:"Keep the order of processes in cgroup.procs instead of sorting them by pid when --sort is not given."`
+	Agg                   []string          `group:"output" short:"g" help:"${agg_help}"`
+	Header                bool              `group:"output" default:"true" negatable:"" help:"Control whether to show the header row."`
+	HeaderRepeat          int               `group:"output" placeholder:"N" help:"Show the header again after every N rows to keep it visible in long output. 0 shows it once. Supported only for --output=table."`
+	Output                string            `group:"output" short:"o" enum:"table,json,ndjson,csv,markdown" default:"table" help:"${output_help}"`
+	Exec                  string            `group:"output" placeholder:"COMMAND" help:"${exec_help}"`
+	Interval              time.Duration     `group:"output" help:"Read processes every interval and stream rows continuously with the \"ts\" key of the time in RFC 3339 format, e.g. for a collector daemon, until interrupted or --timeout. \"pcpu\" is the CPU usage since the previous tick like top, or the average over the lifetime on the first tick. Supported only for --output=ndjson and --exec, or --output=table with --watch-diff."`
+	WatchDiff             bool              `group:"output" help:"With --interval, write the table on every tick with cells whose values changed since the previous tick highlighted: increased numbers in yellow, decreased ones in green, and other changed values in bold. Colors are disabled if stdout is not a terminal or NO_COLOR is set. Supported only for --output=table without --border and --width."`
+	RSSSource             string            `group:"output" name:"rss-source" enum:"stat,statm,smaps" default:"stat" help:"${rss_source_help}"`
+	Timezone              string            `group:"output" env:"SDPS_TIMEZONE" help:"IANA time zone name like \"UTC\" or \"Asia/Tokyo\" used for the \"start\" column. Defaults to the local time zone."`
+	Lang                  string            `group:"output" enum:"en,ja,de" default:"en" env:"SDPS_LANG" help:"Language of \"humanRelTime\" for the \"start\" column. \"en\" (English), \"ja\" (Japanese), or \"de\" (German)."`
+	UptimeResolution      string            `group:"output" enum:"ns,s,m,h" default:"s" help:"${uptime_resolution_help}"`
+	IDKind                string            `group:"output" name:"id-kind" enum:"real,effective,saved,fs" default:"effective" help:"${id_kind_help}"`
+	WarnUptime            time.Duration     `group:"output" help:"Mark uptime values younger than this duration with \"*\" to spot recently restarted processes. Requires the \"uptime\" column."`
+	MinWidth              map[string]int    `group:"output" help:"Minimum width of columns for table output, e.g. \"rss=10\", to keep widths stable across runs."`
+	MaxWidth              map[string]int    `group:"output" help:"Maximum width of columns for table output, e.g. \"command=40\". Longer values are truncated with an ellipsis."`
+	CmdlineRaw            bool              `group:"output" help:"Write the command column as an array of arguments in json and ndjson output to preserve arguments containing spaces. Other outputs keep the joined form."`
+	Typed                 bool              `group:"output" help:"${typed_help}"`
+	Pad                   map[string]int    `group:"output" help:"Pad numeric values of columns with leading zeros to the width, e.g. \"pid=6\". Non-numeric values like \"-\" are not padded. Padded values fill the width, so they look right aligned regardless of the alignment."`
+	CommandMax            int               `group:"output" help:"Truncate the command column to this number of characters with an ellipsis. 0 means no limit."`
+	Width                 int               `group:"output" help:"Truncate lines of table output to this number of characters with an ellipsis. 0 means no limit. This is applied after --max-width and --command-max."`
+	NoTrunc               bool              `group:"output" help:"Disable all truncation by --max-width, --command-max, and --width to show full values, e.g. for logging. This takes precedence over them."`
+	ASCIIOnly             bool              `group:"output" name:"ascii-only" help:"Replace non-ASCII characters in the output like those in command lines with \"?\" for strict-ASCII log pipelines. Borders of --border are drawn with \"+\", \"-\", and \"|\". Output of --exec is not affected."`
+	Verbose               bool              `short:"V" xor:"verbosity" help:"Show diagnostic messages such as files read, pid counts, and timings of each phase to stderr."`
+	Quiet                 bool              `short:"q" xor:"verbosity" help:"Suppress warnings and informational messages on stderr. Errors which abort the run are still shown and the exit code is not affected."`
+	Bench                 bool              `hidden:"" help:"Show elapsed time of each phase to stderr after output."`
+	Debug                 bool              `hidden:"" help:"Enable the \"utime\", \"stime\", and \"starttime\" columns of raw clock ticks and show the boot time and the system uptime to stderr after output, to verify calculations of \"pcpu\" and \"uptime\"."`
+	PrintCommand          bool              `hidden:"" help:"Show the command line of the configuration resolved from flags, environment variables, defaults, and --preset to stderr for bug reports, and proceed."`
+	Root                  string            `type:"existingdir" help:"Read /proc and /sys files under this directory which mirrors \"/\" of a system, e.g. files captured for offline analysis. systemctl is not used with this flag."`
+	PageSize              int               `placeholder:"BYTES" help:"Page size in bytes used to calculate \"rss\" from pages, which must be a power of two, e.g. that of the system of files captured for --root. 0 means the page size of this system."`
+	ClkTck                int               `name:"clk-tck" placeholder:"HZ" help:"Number of clock ticks per second used to calculate \"start\", \"uptime\", and \"pcpu\", e.g. that of the system of files captured for --root. 0 means 100, which is the value on Linux except for alpha and ia64."`
+	BootTime              time.Time         `placeholder:"RFC3339" help:"Boot time used to calculate \"start\" in place of btime in /proc/stat, e.g. for files captured for --root, like \"2024-01-02T15:04:05+09:00\"."`
+	SystemUptime          time.Duration     `help:"System uptime used to calculate \"uptime\" and \"pcpu\" in place of /proc/uptime, e.g. for files captured for --root. 0 means reading /proc/uptime."`
+	NoSystemctl           bool              `help:"Do not run systemctl and rely only on cgroup.procs of services, where a missing cgroup is reported as \"no such service or not started\". This is implied if systemctl is not found. --main-pid, --ppid-filter=main, and the \"ismain\" column are not supported."`
+	Timeout               time.Duration     `help:"Abort if the whole operation does not finish within this duration. 0 means no timeout."`
+	FieldsHelp            bool              `required:"" xor:"entry" help:"Show available columns with their titles, alignments, value types, and formatting functions, and exit."`
+	Version               bool              `required:"" xor:"entry" help:"Show version and exit."`
+
+	// flagsValidated is set to true when run has validated flags, after
+	// which errors are of reading processes, e.g. on a tick of --interval.
+	flagsValidated bool `kong:"-"`
+	// prevSamples is samples of processes on the previous tick of --interval.
+	prevSamples processSamples `kong:"-"`
 }
 
 const (
@@ -83,99 +227,658 @@ const (
 )
 
 const (
-	aggMin = "min"
+	aggMin   = "min"
+	aggCount = "count"
 )
 
 const (
-	fieldPID     = "pid"
-	fieldPPID    = "ppid"
-	fieldPCPU    = "pcpu"
-	fieldVSZ     = "vsz"
-	fieldRSS     = "rss"
-	fieldStart   = "start"
-	fieldUptime  = "uptime"
-	fieldCommand = "command"
+	outputTable    = "table"
+	outputJSON     = "json"
+	outputNDJSON   = "ndjson"
+	outputCSV      = "csv"
+	outputMarkdown = "markdown"
 )
 
-var fieldTitles = map[string]string{
-	fieldPID:     "PID",
-	fieldPPID:    "PPID",
-	fieldPCPU:    "%CPU",
-	fieldVSZ:     "VSZ",
-	fieldRSS:     "RSS",
-	fieldStart:   "START",
-	fieldUptime:  "UPTIME",
-	fieldCommand: "COMMAND",
+const (
+	fieldPID      = procfs.FieldPID
+	fieldPPID     = procfs.FieldPPID
+	fieldPCPU     = procfs.FieldPCPU
+	fieldPMEM     = procfs.FieldPMEM
+	fieldVSZ      = procfs.FieldVSZ
+	fieldRSS      = procfs.FieldRSS
+	fieldVSZPeak  = procfs.FieldVSZPeak
+	fieldRSSPeak  = procfs.FieldRSSPeak
+	fieldRSSLim   = procfs.FieldRSSLim
+	fieldVolCS    = procfs.FieldVolCS
+	fieldNonVolCS = procfs.FieldNonVolCS
+	fieldCPU      = procfs.FieldCPU
+	fieldRTPrio   = procfs.FieldRTPrio
+	fieldStart    = procfs.FieldStart
+	fieldUptime   = procfs.FieldUptime
+	fieldCommand  = procfs.FieldCommand
+	fieldComm     = procfs.FieldComm
+	fieldUser     = procfs.FieldUser
+	fieldGroup    = procfs.FieldGroup
+	fieldListen   = procfs.FieldListen
+	fieldIsMain   = procfs.FieldIsMain
+	fieldTasks    = procfs.FieldTasks
+	fieldHost     = procfs.FieldHost
+	fieldBootID   = procfs.FieldBootID
+	// fieldCount is the column added by --dedupe-by.
+	fieldCount = "count"
+	// fieldCPURate and fieldRSSRate are the changes per second since the
+	// previous tick of --interval.
+	fieldCPURate = "cpu_rate"
+	fieldRSSRate = "rss_rate"
+)
+
+// ppidFilterMain is the value of --ppid-filter to select children of
+// the main process of each service.
+const ppidFilterMain = "main"
+
+// fieldAll is expanded to all available fields in the column flag.
+const fieldAll = "all"
+
+// AfterApply is called by kong after flags are parsed.
+func (c *CLI) AfterApply(kctx *kong.Context) error {
+	if err := c.applyPreset(kctx); err != nil {
+		return err
+	}
+	if c.PrintCommand {
+		fmt.Fprintln(os.Stderr, resolvedCommand(kctx))
+	}
+	return nil
+}
+
+// dropTimeAttr drops the time from log records, which is not useful for
+// warnings of a single run shown on a terminal.
+func dropTimeAttr(groups []string, a slog.Attr) slog.Attr {
+	if len(groups) == 0 && a.Key == slog.TimeKey {
+		return slog.Attr{}
+	}
+	return a
 }
 
 func (c *CLI) Run(ctx context.Context) error {
+	if c.Verbose {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level: slog.LevelDebug,
+		})))
+	} else if c.Quiet {
+		slog.SetDefault(slog.New(slog.DiscardHandler))
+	} else {
+		slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{
+			Level:       slog.LevelInfo,
+			ReplaceAttr: dropTimeAttr,
+		})))
+	}
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	if c.Interval > 0 && !c.Version && !c.FieldsHelp {
+		return c.runEveryInterval(ctx)
+	}
+	err := c.run(ctx)
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("timed out after %s: %w", c.Timeout, ctx.Err())
+	}
+	return err
+}
+
+func (c *CLI) run(ctx context.Context) error {
 	if c.Version {
+		if c.Output == outputJSON {
+			return json.NewEncoder(os.Stdout).Encode(versionInfo())
+		}
 		fmt.Println(version())
 		return nil
 	}
 
-	sysValCache := NewSysValueCache()
+	if c.FieldsHelp {
+		return writeFieldsHelp(os.Stdout, c.Align, c.DefaultAlign)
+	}
+
+	procfs.SetRootDir(c.Root)
+	if c.CgroupRoot != "" {
+		if !path.IsAbs(c.CgroupRoot) {
+			return fmt.Errorf("flag --cgroup-root must be an absolute path: %s", c.CgroupRoot)
+		}
+		cgroupRoot = path.Clean(c.CgroupRoot)
+	} else {
+		cgroupRoot = detectCgroupRoot()
+	}
+	noSystemctl = c.NoSystemctl || (!procfs.IsOffline() && !systemctlFound())
+	if !useSystemctl() && c.MainPID {
+		return errSystemctlRequired("flag --main-pid")
+	}
+	if len(c.Cgroup) > 0 && c.MainPID {
+		return errors.New("flag --main-pid cannot be used with --cgroup")
+	}
+	if c.PPidFilter != "" {
+		if c.MainPID {
+			return errors.New("flag --ppid-filter cannot be used with --main-pid")
+		}
+		if c.PPidFilter == ppidFilterMain {
+			if len(c.Cgroup) > 0 {
+				return errors.New("flag --ppid-filter=main cannot be used with --cgroup")
+			}
+			if !useSystemctl() {
+				return errSystemctlRequired("flag --ppid-filter=main")
+			}
+		} else if _, err := strconv.Atoi(c.PPidFilter); err != nil {
+			return fmt.Errorf("invalid value for --ppid-filter: %s, must be a PID or %q", c.PPidFilter, ppidFilterMain)
+		}
+	}
+
+	if c.PageSize < 0 || c.PageSize&(c.PageSize-1) != 0 {
+		return fmt.Errorf("invalid value for --page-size: %d, must be a positive power of two", c.PageSize)
+	}
+
+	if c.SystemUptime < 0 {
+		return fmt.Errorf("invalid value for --system-uptime: %s, must be positive", c.SystemUptime)
+	}
+	if c.ClkTck < 0 || c.ClkTck > procfs.MaxClkTck {
+		return fmt.Errorf("invalid value for --clk-tck: %d, must be positive and not larger than %d", c.ClkTck, procfs.MaxClkTck)
+	}
+	procfs.SetClkTck(c.ClkTck)
+
+	sysValCache := procfs.NewSysValueCache(ctx)
+	if c.PageSize > 0 {
+		sysValCache.GetPageSize = func() (int, error) { return c.PageSize, nil }
+	}
+	if !c.BootTime.IsZero() {
+		sysValCache.GetBootTime = func() (time.Time, error) { return c.BootTime, nil }
+	}
+	if c.SystemUptime > 0 {
+		sysValCache.GetSystemUptime = func() (time.Duration, error) { return c.SystemUptime, nil }
+	}
+	debugMode = c.Debug
+	if c.Debug {
+		defer writeDebugSysValues(os.Stderr, sysValCache)
+	}
+
+	loc := time.Local
+	if c.Timezone != "" {
+		var err error
+		loc, err = time.LoadLocation(c.Timezone)
+		if err != nil {
+			return fmt.Errorf("invalid timezone: %s, err=%s", c.Timezone, err)
+		}
+	}
+
+	if c.NoTrunc {
+		c.MaxWidth = nil
+		c.CommandMax = 0
+		c.Width = 0
+	}
 
-	columns, err := buildColumns(sysValCache, c.Column, c.Format, c.Align, c.DefaultAlign)
+	var unavailable []string
+	if len(c.Cgroup) > 0 || !useSystemctl() {
+		unavailable = append(unavailable, fieldIsMain)
+	}
+	if c.Interval == 0 {
+		unavailable = append(unavailable, fieldCPURate, fieldRSSRate)
+	}
+	columns, err := buildColumns(sysValCache, expandAllFields(splitColumnFlag(c.Column), unavailable), c.Format, c.Align, c.DefaultAlign, loc, c.Lang)
 	if err != nil {
 		return err
 	}
 
-	if c.Agg != "" {
+	var agg string
+	var columnAggs map[string]string
+	switch {
+	case isColumnAggs(c.Agg):
+		columnAggs, err = parseColumnAggs(c.Agg, columns)
+		if err != nil {
+			return err
+		}
+	case len(c.Agg) > 1:
+		return errors.New("flag --agg takes a single value unless values are like \"rss:sum,pcpu:max\"")
+	case len(c.Agg) == 1:
+		agg = c.Agg[0]
+	}
+	switch agg {
+	case "":
+	case aggMin:
 		if len(columns) != 1 || columns[0].Field != fieldUptime {
-			return errors.New("flag --agg is supported only for --field=UPTIME")
+			return errors.New("flag --agg=min is supported only for --field=UPTIME")
 		}
-		if c.Agg != aggMin {
-			return errors.New("only supported value for flag --agg is \"min\"")
+	case aggCount:
+		// The values of columns are not needed to count processes.
+		columns = []Column{newCountColumn()}
+	default:
+		return fmt.Errorf("invalid value for flag --agg: %s, must be %q or %q", agg, aggMin, aggCount)
+	}
+	if len(c.Agg) > 0 && c.DedupeBy != "" {
+		return errors.New("flag --dedupe-by cannot be used with --agg")
+	}
+
+	for i := range columns {
+		if c.AlignNumbersByDecimal {
+			if def, ok := lookupFieldDef(columns[i].Field); ok && def.Type == procfs.FieldTypePercent {
+				columns[i].Align = AlignDecimal
+			}
+		}
+		columns[i].MinWidth = c.MinWidth[columns[i].Field]
+		columns[i].MaxWidth = c.MaxWidth[columns[i].Field]
+		columns[i].ZeroPad = c.Pad[columns[i].Field]
+	}
+
+	sortKeys, err := parseSortKeys(c.Sort)
+	if err != nil {
+		return err
+	}
+	if c.NoSort {
+		if len(sortKeys) > 0 {
+			return errors.New("flag --no-sort cannot be used with --sort")
+		}
+	} else if len(sortKeys) == 0 {
+		// The order of cgroup.procs is not guaranteed to be stable, so
+		// processes are sorted by pid by default for comparable output.
+		sortKeys = []SortKey{{Field: fieldPID}}
+	}
+
+	thresholds, err := parseThresholds(c.Min, c.Max)
+	if err != nil {
+		return err
+	}
+
+	var where whereExpr
+	var whereFields []string
+	if c.Where != "" {
+		where, whereFields, err = parseWhere(c.Where)
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.GroupByService && c.Output != outputTable {
+		return errors.New("flag --group-by-service is supported only for --output=table")
+	}
+	if c.Border && c.Output != outputTable {
+		return errors.New("flag --border is supported only for --output=table")
+	}
+	if c.HeaderRepeat > 0 && (c.Output != outputTable || c.Border) {
+		return errors.New("flag --header-repeat is supported only for --output=table without --border")
+	}
+	if c.Width > 0 && (c.Output != outputTable || c.Border) {
+		return errors.New("flag --width is supported only for --output=table without --border")
+	}
+	if c.Typed && c.Output != outputJSON && c.Output != outputNDJSON && c.Exec == "" {
+		return errors.New("flag --typed is supported only for --output=json, --output=ndjson, or --exec")
+	}
+	if c.GroupByService && c.Exec != "" {
+		return errors.New("flag --group-by-service cannot be used with --exec")
+	}
+	if c.WatchDiff {
+		if c.Interval == 0 {
+			return errors.New("flag --watch-diff requires --interval")
+		}
+		if c.Output != outputTable || c.Border || c.Width > 0 || c.Exec != "" {
+			return errors.New("flag --watch-diff is supported only for --output=table without --border, --width, and --exec")
+		}
+	}
+
+	if c.WarnUptime > 0 && !slices.ContainsFunc(columns, func(column Column) bool {
+		return column.Field == fieldUptime
+	}) {
+		return errors.New("flag --warn-uptime requires the uptime column")
+	}
+
+	fields := append(convertColumnsToFields(columns), sortKeyFields(sortKeys)...)
+	fields = append(fields, thresholdFields(thresholds)...)
+	fields = append(fields, whereFields...)
+	if agg != "" {
+		// pid is used to break ties in aggregation.
+		fields = append(fields, fieldPID)
+	}
+	if c.DedupeBy != "" {
+		if def, ok := lookupFieldDef(c.DedupeBy); !ok || def == countFieldDef {
+			return fmt.Errorf("invalid field for --dedupe-by: %s", c.DedupeBy)
+		}
+		fields = append(fields, c.DedupeBy)
+		columns = append([]Column{newCountColumn()}, columns...)
+	}
+	if c.Interval == 0 {
+		for _, field := range []string{fieldCPURate, fieldRSSRate} {
+			if slices.Contains(fields, field) {
+				return fmt.Errorf("column %s requires --interval", field)
+			}
+		}
+	}
+	if slices.Contains(fields, fieldIsMain) {
+		if len(c.Cgroup) > 0 {
+			return errors.New("column ismain cannot be used with --cgroup")
+		}
+		if !useSystemctl() {
+			return errSystemctlRequired("column ismain")
 		}
 	}
 
-	pids, err := getPidsOfServices(c.Service)
+	c.flagsValidated = true
+
+	var timings PhaseTimings
+	if c.Bench {
+		defer timings.Write(os.Stderr)
+	}
+
+	startTime := time.Now()
+	var pids []procfs.ServicePid
+	if len(c.Cgroup) > 0 {
+		pids, err = getPidsOfCgroups(c.Cgroup)
+	} else if c.MainPID {
+		pids, err = getMainPidsOfServices(ctx, c.Service)
+	} else {
+		pids, err = getPidsOfServices(ctx, c.Service)
+	}
 	if err != nil {
 		return err
 	}
-	records, err := readProcPidStatMulti(pids)
+	if len(c.Cgroup) == 0 {
+		for _, service := range c.Service {
+			if !slices.ContainsFunc(pids, func(pid procfs.ServicePid) bool { return pid.Service == service }) {
+				slog.Warn("no processes in service (not started?)", "service", service)
+			}
+		}
+	}
+	timings.PidDiscovery = time.Since(startTime)
+	slog.Debug("discovered pids", "pids", len(pids), "elapsed", timings.PidDiscovery)
+
+	readOpts := procReadOptions(fields)
+	readOpts.RSSSource = c.RSSSource
+	readOpts.Cmdline = readOpts.Cmdline || c.Filter != ""
+	readOpts.Timings = &timings.Read
+	readOpts.OnError = func(pid int, file string, err error) {
+		slog.Warn("cannot read "+file+", values are shown as missing", "pid", pid, "err", err)
+	}
+	startTime = time.Now()
+	readTime := startTime
+	records, skipped, err := readProcPidStatMulti(ctx, pids, readOpts)
 	if err != nil {
 		return err
 	}
+	if c.ShowErrors {
+		defer writeSkippedProcesses(os.Stderr, skipped)
+	} else if len(skipped) > 0 {
+		slog.Warn("skipped processes which exited or cannot be read, see --show-errors for details",
+			"count", len(skipped))
+	}
+	slog.Debug("read process files", "records", len(records), "status", readOpts.Status,
+		"rssSource", readOpts.RSSSource, "elapsed", time.Since(startTime))
+
+	if !c.ShowKernelThreads {
+		records = slices.DeleteFunc(records, isKernelThread)
+	}
+
+	if len(c.State) > 0 {
+		records = filterProcessRawRecordsWithState(records, c.State)
+	}
+
+	if c.Younger > 0 || c.Older > 0 {
+		sysUptime, err := sysValCache.GetSystemUptime()
+		if err != nil {
+			return err
+		}
+		records, err = filterProcessRawRecordsWithUptime(records, sysUptime,
+			time.Duration(c.Younger), time.Duration(c.Older))
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.PPidFilter != "" {
+		var parents []procfs.ServicePid
+		if c.PPidFilter == ppidFilterMain {
+			parents, err = getMainPidsOfServices(ctx, c.Service)
+			if err != nil {
+				return err
+			}
+		} else {
+			// The PID was validated above. An empty service matches any service.
+			pid, _ := strconv.Atoi(c.PPidFilter)
+			parents = []procfs.ServicePid{{Pid: pid}}
+		}
+		records = filterProcessRawRecordsWithPPid(records, parents)
+	}
 
 	if c.Filter != "" {
+		n := len(records)
 		records = filterProcessRawRecordsWithCmdline(records, c.Filter)
+		if len(records) == 0 {
+			if n > 0 {
+				slog.Info(fmt.Sprintf("filter matched 0 of %d processes", n), "filter", c.Filter)
+			}
+		}
+	}
+
+	var mainPids []procfs.ServicePid
+	if slices.Contains(fields, fieldIsMain) {
+		if c.MainPID {
+			mainPids = pids
+		} else if mainPids, err = getMainPidsOfServices(ctx, c.Service); err != nil {
+			return err
+		}
+	}
+
+	var tasks map[string]string
+	if slices.Contains(fields, fieldTasks) {
+		if len(c.Cgroup) > 0 {
+			tasks, err = readCgroupTasksOfCgroups(c.Cgroup)
+		} else {
+			tasks, err = readCgroupTasksOfServices(c.Service)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
-	rows, err := convertProcessRawRecordsToTableRows(sysValCache, columns, records, c.Agg)
+	startTime = time.Now()
+	var prevSamples processSamples
+	dataList, err := convertProcessRawRecordsToDataList(sysValCache, fields, records, procfs.ConvertOptions{
+		UptimeResolution: uptimeResolutions[c.UptimeResolution],
+		IDKind:           c.IDKind,
+		MainPids:         mainPids,
+		Tasks:            tasks,
+		OnError: func(pid int, field string, err error) {
+			slog.Warn("cannot get value, which is shown as missing", "pid", pid, "field", field, "err", err)
+		},
+	})
 	if err != nil {
 		return err
 	}
+	if c.Interval > 0 {
+		var pageSize int
+		if slices.Contains(fields, fieldRSSRate) {
+			if pageSize, err = sysValCache.GetPageSize(); err != nil {
+				return err
+			}
+		}
+		samples := newProcessSamples(records, readTime, pageSize)
+		applyDeltaCPU(dataList, records, samples, c.prevSamples)
+		applyRates(dataList, records, fields, samples, c.prevSamples)
+		if c.WatchDiff {
+			setSampleData(dataList, records, samples)
+		}
+		prevSamples = c.prevSamples
+		c.prevSamples = samples
+	}
+	if len(thresholds) > 0 {
+		dataList = filterDataListWithThresholds(dataList, thresholds)
+	}
+	if where != nil {
+		dataList = slices.DeleteFunc(dataList, func(data map[string]any) bool {
+			return !where.eval(data)
+		})
+	}
+	warnUptime := c.WarnUptime
+	if agg != "" {
+		if agg == aggMin && len(dataList) == 0 {
+			// The zero uptime of no processes is not a recent start.
+			warnUptime = 0
+		}
+		dataList = aggregateDataList(dataList, agg)
+	} else if columnAggs != nil {
+		dataList = aggregateColumns(dataList, columnAggs)
+	}
+	if c.DedupeBy != "" {
+		dataList = dedupeDataList(dataList, c.DedupeBy, c.DedupeSum)
+	}
+	if len(sortKeys) > 0 {
+		sortDataList(dataList, sortKeys)
+	}
+	timings.Convert = time.Since(startTime)
+	slog.Debug("converted records", "rows", len(dataList), "elapsed", timings.Convert)
+	defer func(startTime time.Time) {
+		timings.Render = time.Since(startTime)
+		slog.Debug("rendered output", "output", c.Output, "elapsed", timings.Render)
+	}(time.Now())
+
+	table := &Table{
+		Columns: columns,
+		NumRows: len(dataList),
+		RenderRow: func(i int) ([]string, error) {
+			row, err := renderRow(columns, dataList[i], warnUptime)
+			if err != nil {
+				return nil, err
+			}
+			if c.CommandMax > 0 {
+				truncateColumn(row, columns, fieldCommand, c.CommandMax)
+			}
+			return row, nil
+		},
+		Services:     servicesOfDataList(dataList),
+		Header:       c.Header,
+		HeaderRepeat: c.HeaderRepeat,
+		Width:        c.Width,
+	}
+	if c.CmdlineRaw {
+		table.Args = argsOfDataList(dataList)
+	}
+	if c.Typed {
+		table.Infos = processInfosOfDataList(columns, dataList)
+	}
+	if c.Interval > 0 {
+		table.Time = readTime
+	}
+	if c.WatchDiff {
+		if prevSamples != nil {
+			fmt.Println()
+		}
+		fmt.Println(readTime.Format(time.RFC3339) + ":")
+		if useColor() {
+			table.Changes = cellChangesOfDataList(columns, dataList, prevSamples)
+		}
+	}
+	if c.Exec != "" {
+		return writeTableToCommand(ctx, c.Exec, table)
+	}
+	if !c.ASCIIOnly {
+		return c.writeTable(os.Stdout, table)
+	}
+	var buf bytes.Buffer
+	if err := c.writeTable(&buf, table); err != nil {
+		return err
+	}
+	_, err = os.Stdout.Write(toASCII(buf.Bytes()))
+	return err
+}
 
-	var unalignedRows [][]string
-	if c.Header {
-		header := convertColumnsToHeader(columns)
-		unalignedRows = make([][]string, 0, 1+len(rows))
-		unalignedRows = append(append(unalignedRows, header), rows...)
-	} else {
-		unalignedRows = rows
+// writeTable writes table with the formatter for --output.
+func (c *CLI) writeTable(w io.Writer, table *Table) error {
+	formatter := outputFormatters[c.Output]
+	if c.Border {
+		formatter = borderFormatter{ASCII: c.ASCIIOnly}
+	}
+	if c.GroupByService {
+		services := c.Service
+		if len(c.Cgroup) > 0 {
+			services = c.Cgroup
+		}
+		for i, serviceTable := range table.SplitByService(services) {
+			if i > 0 {
+				fmt.Fprintln(w)
+			}
+			fmt.Fprintf(w, "%s:\n", services[i])
+			if err := formatter.WriteTable(w, serviceTable); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
+	return formatter.WriteTable(w, table)
+}
 
-	var alignedRows [][]string
-	if len(unalignedRows) <= 1 {
-		alignedRows = unalignedRows
-	} else {
-		alignments := convertColumnsToAlign(columns)
-		alignedRows, err = AlignColumns(unalignedRows, alignments)
+// splitColumnFlag splits values of the column flag, which kong splits by
+// commas, by spaces too, e.g. "pid rss,command".
+func splitColumnFlag(values []string) []string {
+	var fields []string
+	for _, value := range values {
+		fields = append(fields, strings.Fields(value)...)
+	}
+	return fields
+}
+
+// truncateColumn truncates the value of the column for field in row to
+// maxLen characters with an ellipsis.
+func truncateColumn(row []string, columns []Column, field string, maxLen int) {
+	for j, column := range columns {
+		if column.Field == field {
+			row[j] = truncateWithEllipsis(row[j], maxLen)
+		}
+	}
+}
+
+func filterProcessRawRecordsWithState(records []procfs.ProcessRawRecord, states []string) []procfs.ProcessRawRecord {
+	var filtered []procfs.ProcessRawRecord
+	for _, record := range records {
+		if slices.Contains(states, record.State.String()) {
+			filtered = append(filtered, record)
+		}
+	}
+	return filtered
+}
+
+// filterProcessRawRecordsWithUptime returns records whose uptime is shorter
+// than younger and longer than older. Zero younger or older means no limit.
+func filterProcessRawRecordsWithUptime(records []procfs.ProcessRawRecord, sysUptime, younger, older time.Duration) ([]procfs.ProcessRawRecord, error) {
+	var filtered []procfs.ProcessRawRecord
+	for _, record := range records {
+		uptime, err := record.Uptime(sysUptime)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		if (younger == 0 || uptime < younger) && (older == 0 || uptime > older) {
+			filtered = append(filtered, record)
 		}
 	}
+	return filtered, nil
+}
+
+// isKernelThread reports whether the record is a kernel thread.
+func isKernelThread(record procfs.ProcessRawRecord) bool {
+	return record.Flags.IsKernelThread()
+}
 
-	for _, row := range alignedRows {
-		fmt.Println(strings.Join(row, "  "))
+// filterProcessRawRecordsWithPPid returns records whose parent is one of
+// parents in the same service. A parent with an empty service matches
+// processes in any service.
+func filterProcessRawRecordsWithPPid(records []procfs.ProcessRawRecord, parents []procfs.ServicePid) []procfs.ProcessRawRecord {
+	var filtered []procfs.ProcessRawRecord
+	for _, record := range records {
+		if slices.ContainsFunc(parents, func(parent procfs.ServicePid) bool {
+			return (parent.Service == "" || parent.Service == record.Service) &&
+				strconv.Itoa(parent.Pid) == record.PPid.String()
+		}) {
+			filtered = append(filtered, record)
+		}
 	}
-	return nil
+	return filtered
 }
 
-func filterProcessRawRecordsWithCmdline(records []ProcessRawRecord, filter string) []ProcessRawRecord {
-	var filtered []ProcessRawRecord
+func filterProcessRawRecordsWithCmdline(records []procfs.ProcessRawRecord, filter string) []procfs.ProcessRawRecord {
+	var filtered []procfs.ProcessRawRecord
 	for _, record := range records {
 		if strings.Contains(record.Command.String(), filter) {
 			filtered = append(filtered, record)
@@ -188,14 +891,24 @@ type Column struct {
 	Field    string
 	Align    Align
 	Template *template.Template
+	MinWidth int
+	MaxWidth int
+	ZeroPad  int
 }
 
-func buildColumns(sysValCache *SysValueCache, fields []string, funcCalls, alignments map[string]string, defaultAlign string) ([]Column, error) {
+func buildColumns(sysValCache *procfs.SysValueCache, fields []string, funcCalls, alignments map[string]string, defaultAlign string, loc *time.Location, lang string) ([]Column, error) {
 	templateFuncMap := template.FuncMap{
-		"iBytes":   iBytes,
-		"format":   formatTime,
+		"iBytes":     iBytes,
+		"iBytesUnit": iBytesUnit,
+		"iBytesRate": iBytesRate,
+		"pct":        formatPercent,
+		"format": func(layout string, t time.Time) string {
+			return formatTime(layout, t.In(loc))
+		},
+		"epoch":    epoch,
 		"seconds":  seconds,
 		"duration": formatDuration,
+		"argv":     argv,
 	}
 
 	if funcCalls[fieldStart] == "humanRelTime" {
@@ -209,22 +922,17 @@ func buildColumns(sysValCache *SysValueCache, fields []string, funcCalls, alignm
 		}
 		now := bootTime.Add(sysUptime)
 		templateFuncMap["humanRelTime"] = func(then time.Time) string {
-			return humanize.RelTime(then, now, "ago", "from now")
+			return relTimeLangs[lang].relTime(then, now)
 		}
 	}
 
 	columns := make([]Column, len(fields))
 	for i, field := range fields {
-		switch field {
-		case fieldPID, fieldPPID, fieldPCPU, fieldVSZ, fieldRSS, fieldStart,
-			fieldUptime, fieldCommand:
-
-			columns[i].Field = field
-		default:
-			return nil, fmt.Errorf("invalid field: %s, must be one of %s", field,
-				strings.Join([]string{fieldPID, fieldPPID, fieldVSZ, fieldRSS, fieldStart,
-					fieldUptime, "or " + fieldCommand}, ", "))
+		def, ok := lookupFieldDef(field)
+		if !ok || def == countFieldDef {
+			return nil, invalidFieldError(field)
 		}
+		columns[i].Field = field
 
 		a, ok := alignments[field]
 		if !ok {
@@ -240,15 +948,19 @@ func buildColumns(sysValCache *SysValueCache, fields []string, funcCalls, alignm
 		}
 
 		var tmplText string
-		if funcCall, ok := funcCalls[field]; ok {
-			tmplText = fmt.Sprintf("{{.%s|%s}}", field, funcCall)
+		// An empty function like "rss=" means showing the raw value.
+		if funcCall := funcCalls[field]; funcCall != "" {
+			tmplText = fmt.Sprintf("{{%s|%s}}", fieldRef(field), funcCall)
 		} else {
-			tmplText = fmt.Sprintf("{{.%s}}", field)
+			tmplText = fmt.Sprintf("{{%s}}", fieldRef(field))
 		}
 		tmpl, err := template.New("").Funcs(templateFuncMap).Parse(tmplText)
 		if err != nil {
 			return nil, fmt.Errorf("cannot parse template: %s, err=%s", tmplText, err)
 		}
+		if err := validateFuncArgs(tmpl.Tree.Root); err != nil {
+			return nil, fmt.Errorf("invalid template: %s, err=%s", tmplText, err)
+		}
 		columns[i].Template = tmpl
 	}
 	return columns, nil
@@ -257,11 +969,35 @@ func buildColumns(sysValCache *SysValueCache, fields []string, funcCalls, alignm
 func convertColumnsToHeader(columns []Column) []string {
 	row := make([]string, len(columns))
 	for i, column := range columns {
-		row[i] = fieldTitles[column.Field]
+		row[i] = fieldTitle(column.Field)
 	}
 	return row
 }
 
+func convertColumnsToFields(columns []Column) []string {
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = column.Field
+	}
+	return fields
+}
+
+func convertColumnsToMinWidths(columns []Column) []int {
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = column.MinWidth
+	}
+	return widths
+}
+
+func convertColumnsToMaxWidths(columns []Column) []int {
+	widths := make([]int, len(columns))
+	for i, column := range columns {
+		widths[i] = column.MaxWidth
+	}
+	return widths
+}
+
 func convertColumnsToAlign(columns []Column) []Align {
 	config := make([]Align, len(columns))
 	for i, column := range columns {
@@ -270,25 +1006,216 @@ func convertColumnsToAlign(columns []Column) []Align {
 	return config
 }
 
+// unlimitedBytes is the value for an unlimited limit like "rsslim",
+// which is shown as "unlimited" by iBytes and iBytesUnit.
+const unlimitedBytes = math.MaxUint64
+
 func iBytes(b uint64) string {
+	if b == unlimitedBytes {
+		return "unlimited"
+	}
 	return humanize.IBytes(b)
 }
 
+// iBytesRate formats a signed change of bytes per second like "-1.5 MiB/s".
+func iBytesRate(b int) string {
+	if b < 0 {
+		return "-" + humanize.IBytes(uint64(-b)) + "/s"
+	}
+	return humanize.IBytes(uint64(b)) + "/s"
+}
+
+func formatPercent(prec int, p procfs.Percent) string {
+	return strconv.FormatFloat(float64(p), 'f', prec, 64)
+}
+
+var iBytesUnits = map[string]uint64{
+	"B":   1,
+	"KiB": humanize.KiByte,
+	"MiB": humanize.MiByte,
+	"GiB": humanize.GiByte,
+	"TiB": humanize.TiByte,
+	"PiB": humanize.PiByte,
+}
+
+// iBytesUnit formats bytes in the fixed unit. args is the value or
+// the number of digits after the decimal point and the value, since
+// the value is passed as the last argument in a template pipeline.
+func iBytesUnit(unit string, args ...uint64) (string, error) {
+	divisor, ok := iBytesUnits[unit]
+	if !ok {
+		return "", fmt.Errorf("invalid unit for iBytesUnit: %s", unit)
+	}
+	var prec, b uint64
+	switch len(args) {
+	case 1:
+		prec, b = 1, args[0]
+	case 2:
+		prec, b = args[0], args[1]
+	default:
+		return "", errors.New("iBytesUnit takes a unit and optional digits after the decimal point")
+	}
+	if b == unlimitedBytes {
+		return "unlimited", nil
+	}
+	return strconv.FormatFloat(float64(b)/float64(divisor), 'f', int(prec), 64) + " " + unit, nil
+}
+
+// argv returns the first n arguments of the command line joined with spaces.
+// The command name in brackets is returned for an empty command line.
+func argv(n int, c procfs.Cmdline) (string, error) {
+	if n < 1 {
+		return "", fmt.Errorf("argv takes a positive number of arguments to show: %d", n)
+	}
+	args := c.Args()
+	if len(args) == 0 {
+		return c.String(), nil
+	}
+	return strings.Join(args[:min(n, len(args))], " "), nil
+}
+
+// funcArgValidators validate constant arguments of template functions by
+// calling them with the zero value in place of the piped value.
+var funcArgValidators = map[string]func(args []parse.Node) error{
+	"argv": func(args []parse.Node) error {
+		if len(args) != 1 {
+			return nil
+		}
+		if n, ok := args[0].(*parse.NumberNode); ok && n.IsInt {
+			_, err := argv(int(n.Int64), procfs.Cmdline{})
+			return err
+		}
+		return nil
+	},
+	"iBytesUnit": func(args []parse.Node) error {
+		if len(args) == 0 || len(args) > 2 {
+			return errors.New("iBytesUnit takes a unit and optional digits after the decimal point")
+		}
+		unit, ok := args[0].(*parse.StringNode)
+		if !ok {
+			return nil
+		}
+		_, err := iBytesUnit(unit.Text, 0)
+		return err
+	},
+}
+
+// validateFuncArgs reports invalid constant arguments of template functions
+// like "argv 0" or 'iBytesUnit "XiB"' in node, so that they are reported as
+// errors of flags before processes are read instead of on every tick of
+// --interval.
+func validateFuncArgs(node parse.Node) error {
+	switch node := node.(type) {
+	case *parse.ListNode:
+		for _, n := range node.Nodes {
+			if err := validateFuncArgs(n); err != nil {
+				return err
+			}
+		}
+	case *parse.ActionNode:
+		return validateFuncArgs(node.Pipe)
+	case *parse.PipeNode:
+		for _, cmd := range node.Cmds {
+			if err := validateFuncArgs(cmd); err != nil {
+				return err
+			}
+		}
+	case *parse.CommandNode:
+		for _, arg := range node.Args {
+			if err := validateFuncArgs(arg); err != nil {
+				return err
+			}
+		}
+		if ident, ok := node.Args[0].(*parse.IdentifierNode); ok {
+			if validate, ok := funcArgValidators[ident.Ident]; ok {
+				return validate(node.Args[1:])
+			}
+		}
+	}
+	return nil
+}
+
 func formatTime(layout string, t time.Time) string {
 	return t.Format(layout)
 }
 
+// epoch formats t as seconds since the Epoch with the fractional part,
+// which has the precision of clock ticks for "start", e.g. "1700000000.25".
+func epoch(t time.Time) string {
+	s := strconv.FormatInt(t.Unix(), 10)
+	if nsec := t.Nanosecond(); nsec != 0 {
+		s += "." + strings.TrimRight(fmt.Sprintf("%09d", nsec), "0")
+	}
+	return s
+}
+
 func seconds(d time.Duration) string {
 	return strconv.FormatInt(int64(d/time.Second), 10)
 }
 
-func formatDuration(d time.Duration) string {
-	const (
-		dayDuration   = 24 * time.Hour
-		yearDuration  = time.Duration(365.25 * float64(dayDuration))
-		monthDuration = yearDuration / 12
-	)
+// LongDuration is a duration flag which accepts "y" (365.25 days),
+// "M" (30.4375 days), "w" (7 days), and "d" (24 hours) units in this order
+// before Go's duration like "1y2M3d4h5m", same as formatted by "duration".
+type LongDuration time.Duration
+
+func (d *LongDuration) Decode(ctx *kong.DecodeContext) error {
+	var s string
+	if err := ctx.Scan.PopValueInto("duration", &s); err != nil {
+		return err
+	}
+	v, err := parseLongDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = LongDuration(v)
+	return nil
+}
+
+var longDurationRegexp = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)M)?(?:(\d+)w)?(?:(\d+)d)?(.*)$`)
+
+// parseLongDuration parses a positive LongDuration.
+func parseLongDuration(s string) (time.Duration, error) {
+	m := longDurationRegexp.FindStringSubmatch(s)
+	var d time.Duration
+	hasUnit := false
+	for i, unit := range []time.Duration{yearDuration, monthDuration, weekDuration, dayDuration} {
+		if m[i+1] == "" {
+			continue
+		}
+		hasUnit = true
+		n, err := strconv.ParseInt(m[i+1], 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		if n > (math.MaxInt64-int64(d))/int64(unit) {
+			return 0, fmt.Errorf("invalid duration: %s, which overflows", s)
+		}
+		d += time.Duration(n) * unit
+	}
+	if rest := m[5]; rest != "" || !hasUnit {
+		v, err := time.ParseDuration(rest)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration: %s", s)
+		}
+		if v > 0 && d > math.MaxInt64-v {
+			return 0, fmt.Errorf("invalid duration: %s, which overflows", s)
+		}
+		d += v
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid duration: %s, must be positive", s)
+	}
+	return d, nil
+}
+
+const (
+	dayDuration   = 24 * time.Hour
+	weekDuration  = 7 * dayDuration
+	yearDuration  = time.Duration(365.25 * float64(dayDuration))
+	monthDuration = yearDuration / 12
+)
 
+func formatDuration(d time.Duration) string {
 	if d < 0 {
 		return "-" + formatDuration(-d)
 	}
@@ -320,150 +1247,138 @@ func formatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dy%dM%dd%s", year, month, day, rest)
 }
 
-func convertProcessRawRecordsToTableRows(sysValCache *SysValueCache, columns []Column, records []ProcessRawRecord, agg string) ([][]string, error) {
-	hasPID := false
-	hasPPID := false
-	hasPCPU := false
-	hasVSZ := false
-	hasRSS := false
-	hasStart := false
-	hasUptime := false
-	hasCommand := false
-	for _, column := range columns {
-		switch column.Field {
-		case fieldPID:
-			hasPID = true
-		case fieldPPID:
-			hasPPID = true
-		case fieldPCPU:
-			hasPCPU = true
-		case fieldVSZ:
-			hasVSZ = true
-		case fieldRSS:
-			hasRSS = true
-		case fieldStart:
-			hasStart = true
-		case fieldUptime:
-			hasUptime = true
-		case fieldCommand:
-			hasCommand = true
-		}
-	}
-
-	var err error
-	var pageSize int
-	if hasRSS {
-		pageSize, err = sysValCache.GetPageSize()
-		if err != nil {
-			return nil, err
+// dataKeyService is the key in data for the service name of the process.
+const dataKeyService = procfs.DataKeyService
+
+var uptimeResolutions = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+}
+
+// aggregateDataList returns a single data aggregated from dataList.
+// For aggMin, the data with the minimum uptime is selected, and ties are
+// broken by the smallest pid so that the result is stable across runs.
+// An uptime of zero is returned if dataList is empty.
+// For aggCount, the number of data is returned as fieldCount.
+func aggregateDataList(dataList []map[string]any, agg string) []map[string]any {
+	switch agg {
+	case aggMin:
+		if len(dataList) == 0 {
+			return []map[string]any{{fieldUptime: time.Duration(0)}}
+		}
+		data := dataList[0]
+		for _, d := range dataList[1:] {
+			if c := compareValues(d[fieldUptime], data[fieldUptime]); c < 0 ||
+				(c == 0 && compareValues(d[fieldPID], data[fieldPID]) < 0) {
+				data = d
+			}
 		}
+		return []map[string]any{data}
+	case aggCount:
+		return []map[string]any{{fieldCount: len(dataList)}}
+	default:
+		return dataList
 	}
+}
 
-	var bootTime time.Time
-	if hasStart || hasUptime || hasPCPU {
-		bootTime, err = sysValCache.GetBootTime()
-		if err != nil {
-			return nil, err
-		}
+func servicesOfDataList(dataList []map[string]any) []string {
+	services := make([]string, len(dataList))
+	for i, data := range dataList {
+		services[i], _ = data[dataKeyService].(string)
 	}
+	return services
+}
 
-	var sysUptime time.Duration
-	if hasUptime || hasPCPU {
-		sysUptime, err = sysValCache.GetSystemUptime()
-		if err != nil {
-			return nil, err
+func argsOfDataList(dataList []map[string]any) [][]string {
+	args := make([][]string, len(dataList))
+	for i, data := range dataList {
+		if cmdline, ok := data[fieldCommand].(procfs.Cmdline); ok {
+			args[i] = cmdline.Args()
 		}
 	}
+	return args
+}
 
-	dataList := make([]map[string]any, len(records))
-	for i, record := range records {
-		data := make(map[string]any)
-
-		if hasPID {
-			data[fieldPID] = record.Pid
-		}
-		if hasPPID {
-			data[fieldPPID] = record.PPid
-		}
-		if hasVSZ {
-			vsizeInBytes, err := record.VSize.InBytes()
-			if err != nil {
-				return nil, err
+// processInfosOfDataList returns procfs.ProcessInfo of the columns for each
+// data, with the count of deduplicated processes.
+func processInfosOfDataList(columns []Column, dataList []map[string]any) []procfs.ProcessInfo {
+	fields := make([]string, len(columns))
+	for i, column := range columns {
+		fields[i] = column.Field
+	}
+	infos := procfs.ProcessInfosOf(fields, dataList)
+	if slices.Contains(fields, fieldCount) {
+		for i, data := range dataList {
+			if count, ok := data[fieldCount].(int); ok {
+				infos[i].Count = &count
 			}
-			data[fieldVSZ] = vsizeInBytes
 		}
-		if hasRSS {
-			rssPageCount, err := record.RSS.InPages()
-			if err != nil {
-				return nil, err
+	}
+	if slices.Contains(fields, fieldCPURate) {
+		for i, data := range dataList {
+			if rate, ok := data[fieldCPURate].(procfs.Percent); ok {
+				f := float64(rate)
+				infos[i].CPURate = &f
 			}
-			rssInBytes := rssPageCount * uint64(pageSize)
-			data[fieldRSS] = rssInBytes
 		}
-		if hasStart || hasUptime || hasPCPU {
-			startDur, err := record.StartTime.AsDuration()
-			if err != nil {
-				return nil, err
-			}
-
-			if hasStart {
-				data[fieldStart] = bootTime.Add(startDur)
-			}
-			if hasUptime || hasPCPU {
-				procUptime := sysUptime - startDur
-				if hasUptime {
-					data[fieldUptime] = procUptime.Truncate(time.Second)
-				}
-				if hasPCPU {
-					pcpu, err := record.percentCPU(procUptime)
-					if err != nil {
-						return nil, err
-					}
-					data[fieldPCPU] = fmt.Sprintf("%.1f", pcpu)
-				}
+	}
+	if slices.Contains(fields, fieldRSSRate) {
+		for i, data := range dataList {
+			if rate, ok := data[fieldRSSRate].(int); ok {
+				infos[i].RSSRate = &rate
 			}
 		}
-		if hasCommand {
-			data[fieldCommand] = record.Command
-		}
-
-		dataList[i] = data
 	}
+	return infos
+}
 
-	if agg == aggMin {
-		if len(dataList) > 1 {
-			data := dataList[0]
-			uptime := data[fieldUptime].(time.Duration)
-			for i := range dataList {
-				if dataList[i][fieldUptime].(time.Duration) < uptime {
-					data = dataList[i]
-					uptime = dataList[i][fieldUptime].(time.Duration)
-				}
-			}
-			dataList = []map[string]any{data}
-		} else if len(dataList) == 0 {
-			dataList = []map[string]any{
-				{
-					fieldUptime: time.Duration(0),
-				},
-			}
+// missingValue is shown for a value which cannot be read.
+const missingValue = "-"
+
+func renderRow(columns []Column, data map[string]any, warnUptime time.Duration) ([]string, error) {
+	row := make([]string, len(columns))
+	for j, col := range columns {
+		if _, ok := data[col.Field]; !ok {
+			row[j] = missingValue
+			continue
+		}
+		var err error
+		row[j], err = renderTemplate(col.Template, data)
+		if err != nil {
+			return nil, err
+		}
+		if col.ZeroPad > 0 {
+			row[j] = zeroPad(row[j], col.ZeroPad)
+		}
+		if col.Field == fieldUptime && data[fieldUptime].(time.Duration) < warnUptime {
+			row[j] += recentlyStartedMarker
 		}
 	}
+	return row, nil
+}
 
-	rows := make([][]string, len(dataList))
-	for i, data := range dataList {
-		rows[i] = make([]string, len(columns))
-		for j, col := range columns {
-			var err error
-			rows[i][j], err = renderTemplate(col.Template, data)
-			if err != nil {
-				return nil, err
-			}
-		}
+// decimalNumberRegexp matches a number with an optional sign and an optional
+// fractional part, but not "NaN", "Inf", nor an exponent like "1e5" which
+// strconv.ParseFloat accepts.
+var decimalNumberRegexp = regexp.MustCompile(`^[-+]?[0-9]+(?:\.[0-9]+)?$`)
+
+// zeroPad pads s with leading zeros to width if s is a number.
+func zeroPad(s string, width int) string {
+	if !decimalNumberRegexp.MatchString(s) || len(s) >= width {
+		return s
+	}
+	sign, digits := "", s
+	if s[0] == '-' || s[0] == '+' {
+		sign, digits = s[:1], s[1:]
 	}
-	return rows, nil
+	return sign + strings.Repeat("0", width-len(s)) + digits
 }
 
+// recentlyStartedMarker is appended to uptime values younger than --warn-uptime.
+const recentlyStartedMarker = "*"
+
 func renderTemplate(tmpl *template.Template, data any) (string, error) {
 	var sb strings.Builder
 	if err := tmpl.Execute(&sb, data); err != nil {
@@ -474,27 +1389,32 @@ func renderTemplate(tmpl *template.Template, data any) (string, error) {
 
 var ErrNotStarted = errors.New("not started")
 
-func getPidsOfServices(services []string) ([]int, error) {
-	var pids []int
+func getPidsOfServices(ctx context.Context, services []string) ([]procfs.ServicePid, error) {
+	var pids []procfs.ServicePid
 	for _, service := range services {
-		servicePids, err := getPidsOfService(service)
+		servicePids, err := getPidsOfService(ctx, service)
 		if err != nil && !errors.Is(err, ErrNotStarted) {
 			return nil, err
 		}
-		pids = append(pids, servicePids...)
+		for _, pid := range servicePids {
+			pids = append(pids, procfs.ServicePid{Service: service, Pid: pid})
+		}
 	}
 	return pids, nil
 }
 
-func getPidsOfService(service string) ([]int, error) {
+func getPidsOfService(ctx context.Context, service string) ([]int, error) {
 	if err := validateServiceName(service); err != nil {
 		return nil, err
 	}
-	filename := fmt.Sprintf("/sys/fs/cgroup/system.slice/%s.service/cgroup.procs", service)
-	content, err := os.ReadFile(filename)
+	filename := procfs.HostPath(path.Join(serviceCgroupDir(service), cgroupProcsFile))
+	pids, err := readCgroupProcs(filename)
 	if err != nil {
 		if errors.Is(err, fs.ErrNotExist) {
-			exists, err2 := checkServiceExists(service)
+			if !useSystemctl() {
+				return nil, fmt.Errorf("no such service or not started: %s", service)
+			}
+			exists, err2 := checkServiceExists(ctx, service)
 			if err2 != nil {
 				return nil, err2
 			}
@@ -503,25 +1423,57 @@ func getPidsOfService(service string) ([]int, error) {
 			}
 			return nil, ErrNotStarted
 		}
-		return nil, fmt.Errorf("cannot get pids from %s: %w", filename, err)
+		return nil, err
 	}
+	slog.Debug("read pids of service", "service", service, "pids", len(pids))
+	return pids, nil
+}
 
-	var pids []int
-	scanner := bufio.NewScanner(bytes.NewReader(content))
-	for scanner.Scan() {
-		line := scanner.Text()
-		pid, err := strconv.Atoi(line)
-		if err != nil {
-			return nil, fmt.Errorf("cannot convert pid to int, line=%s, err=%s", line, err)
+func getMainPidsOfServices(ctx context.Context, services []string) ([]procfs.ServicePid, error) {
+	var pids []procfs.ServicePid
+	for _, service := range services {
+		pid, err := getMainPidOfService(ctx, service)
+		if err != nil && !errors.Is(err, ErrNotStarted) {
+			return nil, err
+		}
+		if err == nil {
+			pids = append(pids, procfs.ServicePid{Service: service, Pid: pid})
 		}
-		pids = append(pids, pid)
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, err
 	}
 	return pids, nil
 }
 
+func getMainPidOfService(ctx context.Context, service string) (int, error) {
+	if err := validateServiceName(service); err != nil {
+		return 0, err
+	}
+	outputBytes, err := runSystemctl(ctx, "show", "--property=MainPID", service)
+	if err != nil {
+		return 0, err
+	}
+	const mainPidPrefix = "MainPID="
+	line := strings.TrimSpace(string(outputBytes))
+	if !strings.HasPrefix(line, mainPidPrefix) {
+		return 0, fmt.Errorf("unexpected output of systemctl show for %s: %s", service, line)
+	}
+	pid, err := strconv.Atoi(line[len(mainPidPrefix):])
+	if err != nil {
+		return 0, fmt.Errorf("cannot convert MainPID to int, line=%s, err=%s", line, err)
+	}
+	slog.Debug("got MainPID of service", "service", service, "pid", pid)
+	if pid == 0 {
+		exists, err := checkServiceExists(ctx, service)
+		if err != nil {
+			return 0, err
+		}
+		if !exists {
+			return 0, fmt.Errorf("no such service: %s", service)
+		}
+		return 0, ErrNotStarted
+	}
+	return pid, nil
+}
+
 func validateServiceName(service string) error {
 	if strings.ContainsRune(service, '/') || service == ".." {
 		return errors.New("invalid service name")
@@ -529,54 +1481,141 @@ func validateServiceName(service string) error {
 	return nil
 }
 
-func checkServiceExists(service string) (bool, error) {
-	cmd := exec.Command("systemctl",
-		"show", "--value", "--property=LoadError", service)
-	outputBytes, err := cmd.Output()
+func checkServiceExists(ctx context.Context, service string) (bool, error) {
+	outputBytes, err := runSystemctl(ctx, "show", "--value", "--property=LoadError", service)
 	if err != nil {
 		return false, err
 	}
+	slog.Debug("checked service existence with systemctl", "service", service)
 	const noSuchUnit = "org.freedesktop.systemd1.NoSuchUnit "
 	return !strings.HasPrefix(string(outputBytes), noSuchUnit), nil
 }
 
-type ProcessRawRecord struct {
-	Pid       int
-	PPid      PPid
-	UTime     ClockTicks
-	STime     ClockTicks
-	StartTime ClockTicks
-	VSize     VSize
-	RSS       RSS
-	Command   Cmdline
+// noSystemctl is true not to run systemctl with --no-systemctl or when
+// it is not found.
+var noSystemctl bool
+
+// useSystemctl returns true if systemctl can be run to check services.
+func useSystemctl() bool {
+	return !procfs.IsOffline() && !noSystemctl
 }
 
-func (r *ProcessRawRecord) percentCPU(procUptime time.Duration) (float64, error) {
-	uTimeTicks, err := r.UTime.AsTicks()
-	if err != nil {
-		return 0, fmt.Errorf("failed to convert utime to integer: %s", err)
+func systemctlFound() bool {
+	if _, err := exec.LookPath("systemctl"); err != nil {
+		slog.Debug("systemctl not found", "err", err)
+		return false
 	}
-	sTimeTicks, err := r.STime.AsTicks()
-	if err != nil {
-		return 0, fmt.Errorf("failed to convert stime to integer: %s", err)
+	return true
+}
+
+func errSystemctlRequired(what string) error {
+	return fmt.Errorf("%s requires systemctl, which is not used with --root or --no-systemctl, or is not found", what)
+}
+
+const (
+	systemctlMaxRetries        = 3
+	systemctlInitialRetryDelay = 200 * time.Millisecond
+)
+
+// runSystemctl runs systemctl with args and returns its stdout. It retries
+// with exponential backoff on transient failures like D-Bus timeouts, which
+// happen right after boot or under heavy load. A missing unit is not a
+// failure of systemctl show, so it is not retried.
+func runSystemctl(ctx context.Context, args ...string) ([]byte, error) {
+	delay := systemctlInitialRetryDelay
+	for i := 0; ; i++ {
+		cmd := exec.CommandContext(ctx, "systemctl", args...)
+		outputBytes, err := cmd.Output()
+		if err == nil {
+			return outputBytes, nil
+		}
+		if i == systemctlMaxRetries || !isTransientSystemctlError(err) {
+			return nil, procfs.CommandError(cmd, err)
+		}
+		slog.Debug("retry systemctl", "args", args, "err", procfs.CommandError(cmd, err), "delay", delay)
+		select {
+		case <-ctx.Done():
+			return nil, procfs.CommandError(cmd, err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+// isTransientSystemctlError returns true if the stderr of systemctl shows
+// a failure worth retrying.
+func isTransientSystemctlError(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
 	}
-	uptimeTicks := procUptime / (time.Second / _SYSTEM_CLK_TCK)
-	return float64(uTimeTicks+sTimeTicks) / float64(uptimeTicks) * 100, nil
+	stderr := string(exitErr.Stderr)
+	return strings.Contains(stderr, "timed out") ||
+		strings.Contains(stderr, "Transport endpoint is not connected") ||
+		strings.Contains(stderr, "Resource temporarily unavailable")
 }
 
-func readProcPidStatMulti(pids []int) ([]ProcessRawRecord, error) {
+// pidError is an error of reading files of a process which was skipped.
+type pidError struct {
+	Pid int
+	Err error
+}
+
+// readProcPidStatMulti reads files of processes of pids. Processes which
+// have exited or cannot be read without privileges are skipped and returned
+// as skipped.
+func readProcPidStatMulti(ctx context.Context, pids []procfs.ServicePid, opts procfs.ReadOptions) (records []procfs.ProcessRawRecord, skipped []pidError, err error) {
 	var wg sync.WaitGroup
 	wg.Add(len(pids))
-	records := make([]ProcessRawRecord, len(pids))
+	records = make([]procfs.ProcessRawRecord, len(pids))
 	errors := make([]error, len(pids))
 	for i, pid := range pids {
 		func() {
 			defer wg.Done()
-			records[i], errors[i] = readProcPidStatAndCommand(pid)
+			if ctx.Err() != nil {
+				return
+			}
+			records[i], errors[i] = procfs.ReadProcess(ctx, pid.Pid, opts)
+			records[i].Service = pid.Service
 		}()
 	}
 	wg.Wait()
-	return records, joinErrors(errors...)
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	n := 0
+	for i, err := range errors {
+		if err != nil && isSkippableProcReadError(err) {
+			slog.Debug("skip process", "pid", pids[i].Pid, "err", err)
+			skipped = append(skipped, pidError{Pid: pids[i].Pid, Err: err})
+			errors[i] = nil
+			continue
+		}
+		records[n] = records[i]
+		n++
+	}
+	return records[:n], skipped, joinErrors(errors...)
+}
+
+// isSkippableProcReadError returns true for errors of processes which
+// have exited or cannot be read without privileges.
+func isSkippableProcReadError(err error) bool {
+	return errors.Is(err, fs.ErrNotExist) ||
+		errors.Is(err, syscall.ESRCH) ||
+		errors.Is(err, fs.ErrPermission)
+}
+
+// writeSkippedProcesses writes the summary of skipped processes for
+// --show-errors.
+func writeSkippedProcesses(w io.Writer, skipped []pidError) {
+	if len(skipped) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "skipped processes (%d):\n", len(skipped))
+	for _, e := range skipped {
+		fmt.Fprintf(w, "  pid %d: %s\n", e.Pid, e.Err)
+	}
 }
 
 func joinErrors(errs ...error) error {
@@ -598,175 +1637,6 @@ func joinErrors(errs ...error) error {
 	}
 }
 
-func readProcPidStatAndCommand(pid int) (ProcessRawRecord, error) {
-	record, err := readProcPidStat(pid)
-	var err2 error
-	record.Command, err2 = readProdPidCmdline(pid)
-	return record, joinErrors(err, err2)
-}
-
-type PPid struct {
-	raw []byte
-}
-
-func (p PPid) String() string {
-	return string(p.raw)
-}
-
-type ClockTicks struct {
-	raw []byte
-}
-
-func (t ClockTicks) AsTicks() (uint64, error) {
-	return strconv.ParseUint(string(t.raw), 10, 64)
-}
-
-func (t ClockTicks) AsDuration() (time.Duration, error) {
-	ticks, err := strconv.ParseUint(string(t.raw), 10, 64)
-	if err != nil {
-		return 0, err
-	}
-	return time.Duration(ticks) * (time.Second / _SYSTEM_CLK_TCK), nil
-}
-
-func (t ClockTicks) String() string {
-	return string(t.raw)
-}
-
-const (
-	// CLK_TCK is the number of clock ticks per second.
-	//
-	// CLK_TCK is a constant on Linux for all architectures except alpha and ia64.
-	// See e.g.
-	// https://git.musl-libc.org/cgit/musl/tree/src/conf/sysconf.c#n30
-	// https://github.com/containerd/cgroups/pull/12
-	// https://lore.kernel.org/lkml/agtlq6$iht$1@penguin.transmeta.com/
-	//
-	// copied from https://github.com/tklauser/go-sysconf/blob/v0.3.15/sysconf_linux.go#L18-L25
-	_SYSTEM_CLK_TCK = 100
-)
-
-type VSize struct {
-	raw []byte
-}
-
-func (s VSize) String() string {
-	return string(s.raw)
-}
-
-func (s VSize) InBytes() (uint64, error) {
-	return strconv.ParseUint(s.String(), 10, 64)
-}
-
-type RSS struct {
-	raw []byte
-}
-
-func (r RSS) String() string {
-	return string(r.raw)
-}
-
-func (r RSS) InPages() (uint64, error) {
-	return strconv.ParseUint(r.String(), 10, 64)
-}
-
-func readProcPidStat(pid int) (ProcessRawRecord, error) {
-	//  (1) pid  %d
-	//         The process ID.
-	//
-	//  ...(snip)...
-	//
-	//  (4) ppid  %d
-	//         The PID of the parent of this process.
-	//
-	//  ...(snip)...
-	//
-	//  (14) utime  %lu
-	//         Amount of time that this process has been scheduled
-	//         in user mode, measured in clock ticks (divide by
-	//         sysconf(_SC_CLK_TCK)).  This includes guest time,
-	//         guest_time (time spent running a virtual CPU, see
-	//         below), so that applications that are not aware of
-	//         the guest time field do not lose that time from
-	//         their calculations.
-	//
-	//  (15) stime  %lu
-	//         Amount of time that this process has been scheduled
-	//         in kernel mode, measured in clock ticks (divide by
-	//         sysconf(_SC_CLK_TCK)).
-	//
-	//  ...(snip)...
-	//
-	//  (22) starttime  %llu
-	//         The time the process started after system boot.
-	//         Before Linux 2.6, this value was expressed in
-	//         jiffies.  Since Linux 2.6, the value is expressed in
-	//         clock ticks (divide by sysconf(_SC_CLK_TCK)).
-	//
-	//  (23) vsize  %lu
-	//         Virtual memory size in bytes.
-	//
-	//  (24) rss  %ld
-	//         Resident Set Size: number of pages the process has
-	//         in real memory.  This is just the pages which count
-	//         toward text, data, or stack space.  This does not
-	//         include pages which have not been demand-loaded in,
-	//         or which are swapped out.  This value is inaccurate;
-	//         see /proc/pid/statm below.
-	//
-	// https://man7.org/linux/man-pages/man5/proc_pid_stat.5.html
-	filename := fmt.Sprintf("/proc/%d/stat", pid)
-	content, err := os.ReadFile(filename)
-	if err != nil {
-		return ProcessRawRecord{}, fmt.Errorf("cannot read %s: %s", filename, err)
-	}
-	const ppidIdx = 4
-	const utimeIdx = 14
-	const stimeIdx = 15
-	const startTimeIdx = 22
-	const vsizeIdx = 23
-	const rssIdx = 24
-	i := 1
-	record := ProcessRawRecord{Pid: pid}
-	for word := range bytes.SplitSeq(content, []byte{' '}) {
-		switch i {
-		case ppidIdx:
-			record.PPid = PPid{raw: word}
-		case utimeIdx:
-			record.UTime = ClockTicks{raw: word}
-		case stimeIdx:
-			record.STime = ClockTicks{raw: word}
-		case startTimeIdx:
-			record.StartTime = ClockTicks{raw: word}
-		case vsizeIdx:
-			record.VSize = VSize{raw: word}
-		case rssIdx:
-			record.RSS = RSS{raw: word}
-			return record, nil
-		}
-		i++
-	}
-	return ProcessRawRecord{}, errors.New("cannot find starttime")
-}
-
-type Cmdline struct {
-	raw []byte
-}
-
-func (c Cmdline) String() string {
-	cmd := bytes.TrimRight(c.raw, "\x00")
-	return string(bytes.ReplaceAll(cmd, []byte{'\x00'}, []byte{' '}))
-}
-
-func readProdPidCmdline(pid int) (Cmdline, error) {
-	filename := fmt.Sprintf("/proc/%d/cmdline", pid)
-	content, err := os.ReadFile(filename)
-	if err != nil {
-		return Cmdline{}, fmt.Errorf("cannot read %s: %s", filename, err)
-	}
-	return Cmdline{raw: content}, nil
-}
-
 func main() {
 	ctx := kong.Parse(&cli,
 		kong.Name(cliName),
@@ -780,9 +1650,75 @@ func main() {
 	ctx.FatalIfErrorf(err)
 }
 
+// Version, Commit, and Date are set at build time with
+// -ldflags "-X main.Version=... -X main.Commit=... -X main.Date=...".
+var (
+	Version string
+	Commit  string
+	Date    string
+)
+
 func version() string {
-	if info, ok := debug.ReadBuildInfo(); ok {
-		return info.Main.Version
+	v := Version
+	if v == "" {
+		if info, ok := debug.ReadBuildInfo(); ok {
+			v = info.Main.Version
+		}
+	}
+	if v == "" {
+		v = "(devel)"
+	}
+
+	var extras []string
+	if Commit != "" {
+		extras = append(extras, "commit "+Commit)
+	}
+	if Date != "" {
+		extras = append(extras, "built at "+Date)
+	}
+	if len(extras) > 0 {
+		v += " (" + strings.Join(extras, ", ") + ")"
+	}
+	return v
+}
+
+type VersionInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit,omitempty"`
+	Date      string `json:"date,omitempty"`
+	GoVersion string `json:"goVersion"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+}
+
+func versionInfo() VersionInfo {
+	info := VersionInfo{
+		Version:   Version,
+		Commit:    Commit,
+		Date:      Date,
+		GoVersion: runtime.Version(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		if info.Version == "" {
+			info.Version = buildInfo.Main.Version
+		}
+		for _, setting := range buildInfo.Settings {
+			switch setting.Key {
+			case "vcs.revision":
+				if info.Commit == "" {
+					info.Commit = setting.Value
+				}
+			case "vcs.time":
+				if info.Date == "" {
+					info.Date = setting.Value
+				}
+			}
+		}
+	}
+	if info.Version == "" {
+		info.Version = "(devel)"
 	}
-	return "(devel)"
+	return info
 }
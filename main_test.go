@@ -0,0 +1,225 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/hnakamur/sdps/procfs"
+)
+
+func TestRenderRowDoesNotEscapeHTML(t *testing.T) {
+	const value = `node -e 'a<b && c>"d"'`
+	columns, err := buildColumns(procfs.NewSysValueCache(context.Background()), []string{"env:CMD"},
+		nil, nil, alignLeft, time.UTC, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	row, err := renderRow(columns, map[string]any{"env:CMD": value}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{value}; !slices.Equal(row, want) {
+		t.Errorf("got %q, want %q", row, want)
+	}
+}
+
+// setFixtureRoot writes files keyed by absolute paths like "/proc/1/stat"
+// into a temporary directory and sets it as the root directory until the
+// end of the test.
+func setFixtureRoot(t *testing.T, files map[string]string) {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		filename := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	procfs.SetRootDir(dir)
+	t.Cleanup(func() { procfs.SetRootDir("") })
+}
+
+// fixtureStat is the content of /proc/<pid>/stat of a process named "node".
+const fixtureStat = "1 (node) S 0 0 0 0 -1 4194560 26202 12381 69 58 82 160 7 3 20 0 6 0 7 24072192 2239 18446744073709551615 1 1 0 0 0 0 0 4096 1088 0 0 0 17 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n"
+
+// readFixtureCmdline returns the command line of a process with the raw
+// content of /proc/<pid>/cmdline.
+func readFixtureCmdline(t *testing.T, raw string) procfs.Cmdline {
+	t.Helper()
+	setFixtureRoot(t, map[string]string{
+		"/proc/1/stat":    fixtureStat,
+		"/proc/1/cmdline": raw,
+	})
+	value, err := procfs.ProcessValue(context.Background(), 1, fieldCommand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value.(procfs.Cmdline)
+}
+
+func TestArgv(t *testing.T) {
+	testCases := []struct {
+		raw  string
+		n    int
+		want string
+	}{
+		{raw: "node\x00server.js\x00--port\x003000\x00", n: 1, want: "node"},
+		{raw: "node\x00server.js\x00--port\x003000\x00", n: 2, want: "node server.js"},
+		{raw: "node\x00server.js\x00--port\x003000\x00", n: 4, want: "node server.js --port 3000"},
+		{raw: "node\x00server.js\x00--port\x003000\x00", n: 10, want: "node server.js --port 3000"},
+		// An empty argument is kept.
+		{raw: "sh\x00\x00-c\x00", n: 3, want: "sh  -c"},
+		// The command name is shown for an empty command line.
+		{raw: "", n: 2, want: "[node]"},
+	}
+	for _, tc := range testCases {
+		got, err := argv(tc.n, readFixtureCmdline(t, tc.raw))
+		if err != nil {
+			t.Errorf("argv(%d, %q): %s", tc.n, tc.raw, err)
+		} else if got != tc.want {
+			t.Errorf("argv(%d, %q) = %q, want %q", tc.n, tc.raw, got, tc.want)
+		}
+	}
+}
+
+func TestArgvInvalidNumber(t *testing.T) {
+	cmdline := readFixtureCmdline(t, "node\x00server.js\x00")
+	for _, n := range []int{0, -1} {
+		if got, err := argv(n, cmdline); err == nil {
+			t.Errorf("argv(%d) = %q, want an error", n, got)
+		}
+	}
+}
+
+func TestZeroPad(t *testing.T) {
+	testCases := []struct {
+		s     string
+		width int
+		want  string
+	}{
+		{s: "42", width: 6, want: "000042"},
+		{s: "-42", width: 6, want: "-00042"},
+		{s: "+42", width: 6, want: "+00042"},
+		{s: "3.5", width: 6, want: "0003.5"},
+		{s: "123456", width: 4, want: "123456"},
+		{s: missingValue, width: 6, want: missingValue},
+		{s: "NaN", width: 6, want: "NaN"},
+		{s: "Inf", width: 6, want: "Inf"},
+		{s: "-Inf", width: 6, want: "-Inf"},
+		{s: "1e5", width: 6, want: "1e5"},
+		{s: "0x1F", width: 6, want: "0x1F"},
+		{s: "1.", width: 6, want: "1."},
+		{s: "8.7 MiB", width: 10, want: "8.7 MiB"},
+	}
+	for _, tc := range testCases {
+		if got := zeroPad(tc.s, tc.width); got != tc.want {
+			t.Errorf("zeroPad(%q, %d) = %q, want %q", tc.s, tc.width, got, tc.want)
+		}
+	}
+}
+
+func TestSplitColumnFlag(t *testing.T) {
+	testCases := []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"-c", "pid,rss,command"}, want: []string{"pid", "rss", "command"}},
+		{args: []string{"-c", "pid rss command"}, want: []string{"pid", "rss", "command"}},
+		{args: []string{"-c", "pid rss,command"}, want: []string{"pid", "rss", "command"}},
+		{args: []string{"-c", " pid,  rss , command "}, want: []string{"pid", "rss", "command"}},
+		{args: []string{"-c", "pid,rss", "-c", "env:NODE_ENV command"}, want: []string{"pid", "rss", "env:NODE_ENV", "command"}},
+	}
+	for _, tc := range testCases {
+		cli := parseTestCLI(t, append([]string{"-s", "foo"}, tc.args...)...)
+		if got := splitColumnFlag(cli.Column); !slices.Equal(got, tc.want) {
+			t.Errorf("%q: got %q, want %q", tc.args, got, tc.want)
+		}
+	}
+}
+
+// parseTestCLI returns CLI with flags parsed from args.
+func parseTestCLI(t *testing.T, args ...string) *CLI {
+	t.Helper()
+	var cli CLI
+	parser, err := kong.New(&cli, cliVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parser.Parse(args); err != nil {
+		t.Fatalf("%q: %s", args, err)
+	}
+	return &cli
+}
+
+func TestParseLongDuration(t *testing.T) {
+	testCases := []struct {
+		s    string
+		want time.Duration
+	}{
+		{s: "5m", want: 5 * time.Minute},
+		{s: "1h30m", want: 90 * time.Minute},
+		{s: "7d", want: 7 * dayDuration},
+		{s: "1d12h", want: 36 * time.Hour},
+		{s: "2w", want: 14 * dayDuration},
+		{s: "1w3d", want: 10 * dayDuration},
+		{s: "1M", want: monthDuration},
+		{s: "1y2M3w4d5h", want: yearDuration + 2*monthDuration + 25*dayDuration + 5*time.Hour},
+		// Zero units are allowed as long as the total is positive.
+		{s: "0d1s", want: time.Second},
+		{s: "292y", want: 292 * yearDuration},
+	}
+	for _, tc := range testCases {
+		got, err := parseLongDuration(tc.s)
+		if err != nil {
+			t.Errorf("%q: %s", tc.s, err)
+		} else if got != tc.want {
+			t.Errorf("%q: got %s, want %s", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestParseLongDurationInvalid(t *testing.T) {
+	testCases := []struct {
+		s       string
+		wantErr string
+	}{
+		{s: "0", wantErr: "must be positive"},
+		{s: "0d", wantErr: "must be positive"},
+		{s: "0w0s", wantErr: "must be positive"},
+		{s: "-5m", wantErr: "must be positive"},
+		{s: "1d-25h", wantErr: "must be positive"},
+		{s: "300y", wantErr: "overflows"},
+		{s: "292y4M", wantErr: "overflows"},
+		{s: "1d2562047h", wantErr: "overflows"},
+		{s: "99999999999999999999d", wantErr: "invalid duration"},
+		{s: "", wantErr: "invalid duration"},
+		{s: "5", wantErr: "invalid duration"},
+		{s: "abc", wantErr: "invalid duration"},
+		{s: "d", wantErr: "invalid duration"},
+		{s: "1x", wantErr: "invalid duration"},
+		{s: "1d2x", wantErr: "invalid duration"},
+		// Units must be in the order of y, M, w, and d.
+		{s: "1d1w", wantErr: "invalid duration"},
+		{s: "1.5d", wantErr: "invalid duration"},
+		{s: " 1d", wantErr: "invalid duration"},
+	}
+	for _, tc := range testCases {
+		got, err := parseLongDuration(tc.s)
+		if err == nil {
+			t.Errorf("%q: got %s, want an error", tc.s, got)
+		} else if !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%q: error %q does not contain %q", tc.s, err, tc.wantErr)
+		}
+	}
+}
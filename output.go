@@ -0,0 +1,454 @@
+//go:build linux
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// Table is rows to be written by an OutputFormatter.
+type Table struct {
+	Columns []Column
+	// NumRows is the number of rows.
+	NumRows int
+	// RenderRow renders the i-th row. Formatters which need all rows to
+	// calculate widths call Rows, and others call RenderRow for each row
+	// to write it as soon as it is rendered.
+	RenderRow func(i int) ([]string, error)
+	// Services is the service name for each row, or "" if unknown.
+	Services []string
+	// Args is the arguments of the command for each row, which are
+	// written as an array in place of the command column by structured
+	// formats. It is nil to write the joined form.
+	Args [][]string
+	// Infos is the typed values of each row written by structured formats
+	// in place of Rows with --typed. It is nil to write formatted values.
+	Infos []procfs.ProcessInfo
+	// Width is the maximum number of characters of lines for table output,
+	// or zero for no limit.
+	Width int
+	// Time is the time when processes were read, which is written with the
+	// "ts" key by ndjson output if it is not zero.
+	Time time.Time
+	// Header is true to write the header if the format supports it.
+	Header bool
+	// HeaderRepeat is the number of rows after which the header is written
+	// again for table output, or zero to write it once.
+	HeaderRepeat int
+	// Changes is the changes of cells of each row since the previous tick
+	// with --watch-diff, which are highlighted with colors by table output.
+	// It is nil to write cells without colors.
+	Changes [][]cellChange
+}
+
+// Rows renders all rows.
+func (t *Table) Rows() ([][]string, error) {
+	rows := make([][]string, t.NumRows)
+	for i := range rows {
+		var err error
+		if rows[i], err = t.RenderRow(i); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// SplitByService returns a table for each service in services.
+func (t *Table) SplitByService(services []string) []*Table {
+	tables := make([]*Table, len(services))
+	for i, service := range services {
+		// indexes is the indexes in t of rows in tables[i].
+		var indexes []int
+		tables[i] = &Table{
+			Columns: t.Columns,
+			Header:  t.Header,
+			RenderRow: func(k int) ([]string, error) {
+				return t.RenderRow(indexes[k])
+			},
+		}
+		for j := range t.NumRows {
+			if t.Services[j] == service {
+				indexes = append(indexes, j)
+				tables[i].Services = append(tables[i].Services, service)
+				if t.Args != nil {
+					tables[i].Args = append(tables[i].Args, t.Args[j])
+				}
+				if t.Infos != nil {
+					tables[i].Infos = append(tables[i].Infos, t.Infos[j])
+				}
+				if t.Changes != nil {
+					tables[i].Changes = append(tables[i].Changes, t.Changes[j])
+				}
+			}
+		}
+		tables[i].NumRows = len(indexes)
+	}
+	return tables
+}
+
+type OutputFormatter interface {
+	WriteTable(w io.Writer, table *Table) error
+}
+
+var outputFormatters = map[string]OutputFormatter{
+	outputTable:    tableFormatter{},
+	outputJSON:     jsonFormatter{},
+	outputNDJSON:   ndjsonFormatter{},
+	outputCSV:      csvFormatter{},
+	outputMarkdown: markdownFormatter{},
+}
+
+type tableFormatter struct{}
+
+func (tableFormatter) WriteTable(w io.Writer, table *Table) error {
+	rows, err := table.Rows()
+	if err != nil {
+		return err
+	}
+	var unalignedRows [][]string
+	// rowIndexes is the index in rows of each of unalignedRows, or -1 for
+	// headers.
+	var rowIndexes []int
+	if table.Header && table.HeaderRepeat > 0 {
+		// Widths are calculated with repeated headers in the rows.
+		header := convertColumnsToHeader(table.Columns)
+		for i, row := range rows {
+			if i%table.HeaderRepeat == 0 {
+				unalignedRows = append(unalignedRows, header)
+				rowIndexes = append(rowIndexes, -1)
+			}
+			unalignedRows = append(unalignedRows, row)
+			rowIndexes = append(rowIndexes, i)
+		}
+		if len(rows) == 0 {
+			unalignedRows = [][]string{header}
+			rowIndexes = []int{-1}
+		}
+	} else if table.Header {
+		header := convertColumnsToHeader(table.Columns)
+		unalignedRows = make([][]string, 0, 1+len(rows))
+		unalignedRows = append(append(unalignedRows, header), rows...)
+		rowIndexes = append([]int{-1}, seqInts(len(rows))...)
+	} else {
+		unalignedRows = rows
+		rowIndexes = seqInts(len(rows))
+	}
+
+	var alignedRows [][]string
+	if len(unalignedRows) <= 1 {
+		alignedRows = unalignedRows
+	} else {
+		alignments := convertColumnsToAlign(table.Columns)
+		alignedRows, err = AlignColumnsWithWidths(unalignedRows, alignments,
+			convertColumnsToMinWidths(table.Columns), convertColumnsToMaxWidths(table.Columns))
+		if err != nil {
+			return err
+		}
+	}
+
+	for k, row := range alignedRows {
+		if i := rowIndexes[k]; i >= 0 && i < len(table.Changes) {
+			row = colorCells(row, table.Changes[i])
+		}
+		line := strings.Join(row, "  ")
+		if table.Width > 0 {
+			line = truncateWithEllipsis(line, table.Width)
+		}
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seqInts returns integers from 0 to n-1.
+func seqInts(n int) []int {
+	ints := make([]int, n)
+	for i := range ints {
+		ints[i] = i
+	}
+	return ints
+}
+
+// cellColors is the ANSI escape sequences to highlight changed cells.
+var cellColors = map[cellChange]string{
+	cellIncreased: "\x1b[33m",
+	cellDecreased: "\x1b[32m",
+	cellChanged:   "\x1b[1m",
+}
+
+// colorCells returns aligned cells of row highlighted with colors of
+// changes. Colors are applied after alignment since escape sequences have
+// no width.
+func colorCells(row []string, changes []cellChange) []string {
+	if changes == nil {
+		return row
+	}
+	colored := make([]string, len(row))
+	for j, cell := range row {
+		if color, ok := cellColors[changes[j]]; ok {
+			cell = color + cell + "\x1b[0m"
+		}
+		colored[j] = cell
+	}
+	return colored
+}
+
+// borderFormatter writes a table like tableFormatter with borders drawn
+// with box-drawing characters around cells, or ASCII characters if ASCII
+// is true.
+type borderFormatter struct {
+	ASCII bool
+}
+
+// borderChars is characters to draw borders. left, cross, and right are
+// for the top rule, the rule below the header, and the bottom rule.
+type borderChars struct {
+	horizontal, vertical string
+	left, cross, right   [3]string
+}
+
+var (
+	boxDrawingBorderChars = borderChars{
+		horizontal: "─",
+		vertical:   "│",
+		left:       [3]string{"┌", "├", "└"},
+		cross:      [3]string{"┬", "┼", "┴"},
+		right:      [3]string{"┐", "┤", "┘"},
+	}
+	asciiBorderChars = borderChars{
+		horizontal: "-",
+		vertical:   "|",
+		left:       [3]string{"+", "+", "+"},
+		cross:      [3]string{"+", "+", "+"},
+		right:      [3]string{"+", "+", "+"},
+	}
+)
+
+func (f borderFormatter) WriteTable(w io.Writer, table *Table) error {
+	chars := boxDrawingBorderChars
+	if f.ASCII {
+		chars = asciiBorderChars
+	}
+	rows, err := table.Rows()
+	if err != nil {
+		return err
+	}
+	if table.Header {
+		rows = append([][]string{convertColumnsToHeader(table.Columns)}, rows...)
+	}
+	if len(rows) == 0 {
+		return nil
+	}
+	alignedRows, err := AlignColumnsWithWidths(rows, convertColumnsToAlign(table.Columns),
+		convertColumnsToMinWidths(table.Columns), convertColumnsToMaxWidths(table.Columns))
+	if err != nil {
+		return err
+	}
+
+	// The last column is not padded if it is aligned left, so widths are
+	// calculated again to pad it for the right border.
+	widths, err := columnWidths(alignedRows)
+	if err != nil {
+		return err
+	}
+	rule := func(i int) string {
+		parts := make([]string, len(widths))
+		for j, width := range widths {
+			parts[j] = strings.Repeat(chars.horizontal, width+2)
+		}
+		return chars.left[i] + strings.Join(parts, chars.cross[i]) + chars.right[i]
+	}
+
+	lines := []string{rule(0)}
+	for i, row := range alignedRows {
+		cells := make([]string, len(row))
+		for j, col := range row {
+			cells[j] = col + strings.Repeat(" ", widths[j]-utf8.RuneCountInString(col))
+		}
+		v := chars.vertical
+		lines = append(lines, v+" "+strings.Join(cells, " "+v+" ")+" "+v)
+		if i == 0 && table.Header && len(alignedRows) > 1 {
+			lines = append(lines, rule(1))
+		}
+	}
+	lines = append(lines, rule(2))
+	for _, line := range lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// jsonFormatter writes an array of objects with formatted column values.
+type jsonFormatter struct{}
+
+func (jsonFormatter) WriteTable(w io.Writer, table *Table) error {
+	if table.Infos != nil {
+		return json.NewEncoder(w).Encode(table.Infos)
+	}
+	objects := make([]map[string]any, table.NumRows)
+	for i := range objects {
+		row, err := table.RenderRow(i)
+		if err != nil {
+			return err
+		}
+		objects[i] = table.rowObject(i, row, len(table.Columns))
+	}
+	return json.NewEncoder(w).Encode(objects)
+}
+
+// rowObject returns an object of the column values in row, which is the
+// i-th row, allocated with room for size keys.
+func (t *Table) rowObject(i int, row []string, size int) map[string]any {
+	object := make(map[string]any, size)
+	for j, column := range t.Columns {
+		if column.Field == fieldCommand && t.Args != nil && t.Args[i] != nil {
+			object[column.Field] = t.Args[i]
+		} else {
+			object[column.Field] = row[j]
+		}
+	}
+	return object
+}
+
+// ndjsonFormatter writes a JSON object per line with the "service" key
+// added when the service is known, and the "ts" key with --interval.
+// Each line is written as soon as the row is rendered, so a consumer can
+// process rows while others are being rendered.
+type ndjsonFormatter struct{}
+
+// dataKeyTime is the key in ndjson output of the time when processes were read.
+const dataKeyTime = "ts"
+
+func (ndjsonFormatter) WriteTable(w io.Writer, table *Table) error {
+	enc := json.NewEncoder(w)
+	if table.Infos != nil {
+		for _, info := range table.Infos {
+			if !table.Time.IsZero() {
+				info.Time = table.Time.Format(time.RFC3339)
+			}
+			if err := enc.Encode(info); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for i := range table.NumRows {
+		row, err := table.RenderRow(i)
+		if err != nil {
+			return err
+		}
+		object := table.rowObject(i, row, len(table.Columns)+1)
+		if service := table.Services[i]; service != "" {
+			object[dataKeyService] = service
+		}
+		if !table.Time.IsZero() {
+			object[dataKeyTime] = table.Time.Format(time.RFC3339)
+		}
+		if err := enc.Encode(object); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type csvFormatter struct{}
+
+func (csvFormatter) WriteTable(w io.Writer, table *Table) error {
+	cw := csv.NewWriter(w)
+	if table.Header {
+		if err := cw.Write(convertColumnsToHeader(table.Columns)); err != nil {
+			return err
+		}
+	}
+	for i := range table.NumRows {
+		row, err := table.RenderRow(i)
+		if err != nil {
+			return err
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// markdownFormatter writes a GitHub-flavored markdown table. The header is
+// always written since a markdown table requires it, and the alignments of
+// columns are written in the delimiter row.
+type markdownFormatter struct{}
+
+func (markdownFormatter) WriteTable(w io.Writer, table *Table) error {
+	delimiters := make([]string, len(table.Columns))
+	for j, column := range table.Columns {
+		if column.Align == AlignLeft {
+			delimiters[j] = ":---"
+		} else {
+			delimiters[j] = "---:"
+		}
+	}
+	writeRow := func(cells []string) error {
+		_, err := fmt.Fprintf(w, "| %s |\n", strings.Join(cells, " | "))
+		return err
+	}
+	if err := writeRow(escapeMarkdownCells(convertColumnsToHeader(table.Columns))); err != nil {
+		return err
+	}
+	if err := writeRow(delimiters); err != nil {
+		return err
+	}
+	for i := range table.NumRows {
+		row, err := table.RenderRow(i)
+		if err != nil {
+			return err
+		}
+		if err := writeRow(escapeMarkdownCells(row)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// markdownCellReplacer escapes "|" and replaces line breaks with "<br>",
+// which would otherwise end the row of a markdown table.
+var markdownCellReplacer = strings.NewReplacer(
+	"|", `\|`,
+	"\r\n", "<br>",
+	"\r", "<br>",
+	"\n", "<br>",
+)
+
+// escapeMarkdownCells returns cells escaped for a markdown table.
+func escapeMarkdownCells(cells []string) []string {
+	escaped := make([]string, len(cells))
+	for j, cell := range cells {
+		escaped[j] = markdownCellReplacer.Replace(cell)
+	}
+	return escaped
+}
+
+// toASCII returns b with non-ASCII characters and invalid bytes replaced
+// with "?".
+func toASCII(b []byte) []byte {
+	out := make([]byte, 0, len(b))
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		if r >= utf8.RuneSelf {
+			r = '?'
+		}
+		out = append(out, byte(r))
+		b = b[size:]
+	}
+	return out
+}
@@ -0,0 +1,198 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// newTestTable returns a table of fixed rows of two services.
+func newTestTable() *Table {
+	rows := [][]string{
+		{"1", "8.7 MiB", "/usr/bin/foo --a|b"},
+		{"12", "0 B", "[kthreadd]"},
+		{"345", "1.2 GiB", "bar"},
+	}
+	return &Table{
+		Columns: []Column{
+			{Field: fieldPID, Align: AlignRight},
+			{Field: fieldRSS, Align: AlignRight},
+			{Field: fieldCommand, Align: AlignLeft},
+		},
+		NumRows: len(rows),
+		RenderRow: func(i int) ([]string, error) {
+			return rows[i], nil
+		},
+		Services: []string{"foo", "foo", "bar"},
+		Header:   true,
+	}
+}
+
+func TestOutputFormatters(t *testing.T) {
+	testCases := []struct {
+		name      string
+		formatter OutputFormatter
+		want      string
+	}{
+		{
+			name:      outputTable,
+			formatter: tableFormatter{},
+			want: `PID      RSS  COMMAND
+  1  8.7 MiB  /usr/bin/foo --a|b
+ 12      0 B  [kthreadd]
+345  1.2 GiB  bar
+`,
+		},
+		{
+			name:      "border",
+			formatter: borderFormatter{ASCII: true},
+			want: `+-----+---------+--------------------+
+| PID |     RSS | COMMAND            |
++-----+---------+--------------------+
+|   1 | 8.7 MiB | /usr/bin/foo --a|b |
+|  12 |     0 B | [kthreadd]         |
+| 345 | 1.2 GiB | bar                |
++-----+---------+--------------------+
+`,
+		},
+		{
+			name:      outputJSON,
+			formatter: jsonFormatter{},
+			want: `[{"command":"/usr/bin/foo --a|b","pid":"1","rss":"8.7 MiB"},` +
+				`{"command":"[kthreadd]","pid":"12","rss":"0 B"},` +
+				`{"command":"bar","pid":"345","rss":"1.2 GiB"}]
+`,
+		},
+		{
+			name:      outputNDJSON,
+			formatter: ndjsonFormatter{},
+			want: `{"command":"/usr/bin/foo --a|b","pid":"1","rss":"8.7 MiB","service":"foo"}
+{"command":"[kthreadd]","pid":"12","rss":"0 B","service":"foo"}
+{"command":"bar","pid":"345","rss":"1.2 GiB","service":"bar"}
+`,
+		},
+		{
+			name:      outputCSV,
+			formatter: csvFormatter{},
+			want: `PID,RSS,COMMAND
+1,8.7 MiB,/usr/bin/foo --a|b
+12,0 B,[kthreadd]
+345,1.2 GiB,bar
+`,
+		},
+		{
+			name:      outputMarkdown,
+			formatter: markdownFormatter{},
+			want: `| PID | RSS | COMMAND |
+| ---: | ---: | :--- |
+| 1 | 8.7 MiB | /usr/bin/foo --a\|b |
+| 12 | 0 B | [kthreadd] |
+| 345 | 1.2 GiB | bar |
+`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tc.formatter.WriteTable(&buf, newTestTable()); err != nil {
+				t.Fatal(err)
+			}
+			if got := buf.String(); got != tc.want {
+				t.Errorf("got\n%s\nwant\n%s", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestEscapeMarkdownCells(t *testing.T) {
+	got := escapeMarkdownCells([]string{
+		"a|b",
+		"line1\nline2",
+		"line1\r\nline2",
+		"line1\rline2",
+		"\n\r\n\r",
+		"plain",
+	})
+	want := []string{
+		`a\|b`,
+		"line1<br>line2",
+		"line1<br>line2",
+		"line1<br>line2",
+		"<br><br><br>",
+		"plain",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestNDJSONFormatterStreamsRows(t *testing.T) {
+	table := newTestTable()
+	var buf bytes.Buffer
+	renderRow := table.RenderRow
+	errRender := errors.New("render error")
+	table.RenderRow = func(i int) ([]string, error) {
+		// Rows before i must have been written before the i-th row is rendered.
+		if got := strings.Count(buf.String(), "\n"); got != i {
+			t.Errorf("%d rows are written before rendering row %d", got, i)
+		}
+		if i == 2 {
+			return nil, errRender
+		}
+		return renderRow(i)
+	}
+	if err := (ndjsonFormatter{}).WriteTable(&buf, table); !errors.Is(err, errRender) {
+		t.Errorf("got error %v, want %v", err, errRender)
+	}
+}
+
+func TestTableSplitByService(t *testing.T) {
+	tables := newTestTable().SplitByService([]string{"bar", "foo", "baz"})
+	want := [][]string{{"345"}, {"1", "12"}, nil}
+	for i, table := range tables {
+		rows, err := table.Rows()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var pids []string
+		for _, row := range rows {
+			pids = append(pids, row[0])
+		}
+		if strings.Join(pids, ",") != strings.Join(want[i], ",") {
+			t.Errorf("table %d: got pids %q, want %q", i, pids, want[i])
+		}
+	}
+}
+
+func TestTableFormatterColorsChanges(t *testing.T) {
+	table := newTestTable()
+	table.HeaderRepeat = 2
+	table.Changes = [][]cellChange{
+		{cellUnchanged, cellIncreased, cellChanged},
+		nil,
+		{cellUnchanged, cellDecreased, cellUnchanged},
+	}
+	var buf bytes.Buffer
+	if err := (tableFormatter{}).WriteTable(&buf, table); err != nil {
+		t.Fatal(err)
+	}
+	// Colors are applied after alignment, and headers are not colored.
+	want := "PID      RSS  COMMAND\n" +
+		"  1  \x1b[33m8.7 MiB\x1b[0m  \x1b[1m/usr/bin/foo --a|b\x1b[0m\n" +
+		" 12      0 B  [kthreadd]\n" +
+		"PID      RSS  COMMAND\n" +
+		"345  \x1b[32m1.2 GiB\x1b[0m  bar\n"
+	if got := buf.String(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// Changes follow rows split by service.
+	tables := table.SplitByService([]string{"bar"})
+	if got := tables[0].Changes; len(got) != 1 || got[0][1] != cellDecreased {
+		t.Errorf("got changes %v, want those of the row of bar", got)
+	}
+}
@@ -0,0 +1,98 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/alecthomas/kong"
+)
+
+// preset is the columns and formats set with --preset.
+type preset struct {
+	Column []string
+	Format FormatMap
+}
+
+var presets = map[string]preset{
+	// ps is like the columns of "ps aux" which are available.
+	"ps": {
+		Column: []string{fieldUser, fieldPID, fieldPCPU, fieldPMEM, fieldVSZ, fieldRSS, fieldStart, fieldCommand},
+		Format: FormatMap{fieldStart: `format "15:04"`},
+	},
+	"mem": {
+		Column: []string{fieldPID, fieldPMEM, fieldRSS, fieldRSSPeak, fieldVSZ, fieldVSZPeak, fieldCommand},
+	},
+	"cpu": {
+		Column: []string{fieldPID, fieldPCPU, fieldCPU, fieldVolCS, fieldNonVolCS, fieldUptime, fieldCommand},
+	},
+}
+
+// applyPreset applies --preset. The column flag set explicitly or with the
+// environment variable is kept, and formats set explicitly, which differ
+// from the defaults, are kept.
+func (c *CLI) applyPreset(kctx *kong.Context) error {
+	if c.Preset == "" {
+		return nil
+	}
+	p, ok := presets[c.Preset]
+	if !ok {
+		names := slices.Sorted(maps.Keys(presets))
+		return fmt.Errorf("invalid value for --preset: %s, must be one of %s", c.Preset, strings.Join(names, ", "))
+	}
+
+	if !isFlagSetByUser(kctx, "column") {
+		c.Column = p.Column
+	}
+	if c.Format == nil {
+		c.Format = make(FormatMap)
+	}
+	defaultFormat := defaultFormatMap(kctx)
+	for field, funcCall := range p.Format {
+		if current, ok := c.Format[field]; !ok || current == defaultFormat[field] {
+			c.Format[field] = funcCall
+		}
+	}
+	return nil
+}
+
+// isFlagSetByUser reports whether the flag is in the command line or its
+// environment variable is set.
+func isFlagSetByUser(kctx *kong.Context, name string) bool {
+	for _, path := range kctx.Path {
+		if path.Flag != nil && path.Flag.Name == name {
+			return true
+		}
+	}
+	for _, flag := range kctx.Flags() {
+		if flag.Name != name {
+			continue
+		}
+		for _, env := range flag.Envs {
+			if _, ok := os.LookupEnv(env); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// defaultFormatMap returns the default value of the format flag.
+func defaultFormatMap(kctx *kong.Context) FormatMap {
+	m := make(FormatMap)
+	for _, flag := range kctx.Flags() {
+		if flag.Name != "format" {
+			continue
+		}
+		for _, entry := range splitFormatEntries(flag.Default) {
+			if field, funcCall, ok := strings.Cut(entry, "="); ok {
+				m[field] = funcCall
+			}
+		}
+	}
+	return m
+}
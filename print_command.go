@@ -0,0 +1,84 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+// resolvedCommand returns the command line of the configuration resolved
+// from flags, environment variables, defaults, and --preset for --print-command.
+// Flags with zero values are omitted.
+func resolvedCommand(kctx *kong.Context) string {
+	args := []string{cliName}
+	for _, flag := range kctx.Flags() {
+		switch flag.Name {
+		case "help", "preset", "print-command":
+			continue
+		}
+		if arg, ok := flagArg(flag); ok {
+			args = append(args, shellQuote(arg))
+		}
+	}
+	return strings.Join(args, " ")
+}
+
+// flagArg returns the argument like "--name=value" for the value of flag.
+func flagArg(flag *kong.Flag) (string, bool) {
+	v := flag.Target
+	if v.Kind() == reflect.Bool {
+		switch {
+		case v.Bool():
+			return "--" + flag.Name, true
+		case flag.Tag.Negatable != "":
+			return "--no-" + flag.Name, true
+		default:
+			return "", false
+		}
+	}
+	if v.IsZero() || (v.Kind() == reflect.Slice || v.Kind() == reflect.Map) && v.Len() == 0 {
+		return "", false
+	}
+
+	var value string
+	switch x := v.Interface().(type) {
+	case time.Duration:
+		value = x.String()
+	case LongDuration:
+		value = time.Duration(x).String()
+	case time.Time:
+		value = x.Format(time.RFC3339Nano)
+	case []string:
+		value = strings.Join(x, ",")
+	default:
+		if v.Kind() == reflect.Map {
+			keys := v.MapKeys()
+			slices.SortFunc(keys, func(a, b reflect.Value) int {
+				return strings.Compare(a.String(), b.String())
+			})
+			entries := make([]string, len(keys))
+			for i, key := range keys {
+				entries[i] = key.String() + "=" + fmt.Sprint(v.MapIndex(key).Interface())
+			}
+			value = strings.Join(entries, ";")
+		} else {
+			value = fmt.Sprint(x)
+		}
+	}
+	return "--" + flag.Name + "=" + value, true
+}
+
+// shellQuote quotes s with single quotes if it has characters other than
+// ones safe in sh.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=.,:/+@%") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
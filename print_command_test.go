@@ -0,0 +1,54 @@
+//go:build linux
+
+package main
+
+import (
+	"maps"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/alecthomas/kong"
+)
+
+func TestFlagArgRoundTrip(t *testing.T) {
+	args := []string{
+		"-s", "nginx,trafficserver",
+		"-c", "pid,rss,command",
+		"-f", "rss=iBytesUnit \"MiB\"",
+		"--boot-time", "2024-01-02T15:04:05.25+09:00",
+		"--system-uptime", "1h30m",
+		"--older", "2d",
+		"--show-kernel-threads",
+	}
+	var want CLI
+	parser, err := kong.New(&want, cliVars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	kctx, err := parser.Parse(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var resolved []string
+	for _, flag := range kctx.Flags() {
+		if flag.Name == "help" {
+			continue
+		}
+		if arg, ok := flagArg(flag); ok {
+			resolved = append(resolved, arg)
+		}
+	}
+	got := parseTestCLI(t, resolved...)
+	if !got.BootTime.Equal(want.BootTime) || got.BootTime.Format(time.RFC3339Nano) != "2024-01-02T15:04:05.25+09:00" {
+		t.Errorf("got boot time %s, want %s", got.BootTime, want.BootTime)
+	}
+	if got.SystemUptime != want.SystemUptime || got.Older != want.Older || got.ShowKernelThreads != want.ShowKernelThreads {
+		t.Errorf("got %s, %s, %v, want %s, %s, %v", got.SystemUptime, time.Duration(got.Older), got.ShowKernelThreads,
+			want.SystemUptime, time.Duration(want.Older), want.ShowKernelThreads)
+	}
+	if !slices.Equal(got.Service, want.Service) || !slices.Equal(got.Column, want.Column) || !maps.Equal(got.Format, want.Format) {
+		t.Errorf("got %q, %q, %q, want %q, %q, %q", got.Service, got.Column, got.Format, want.Service, want.Column, want.Format)
+	}
+}
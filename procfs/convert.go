@@ -0,0 +1,68 @@
+//go:build linux
+
+package procfs
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// DataKeyService is the key in data of Convert for the service name of
+// the process.
+const DataKeyService = "service"
+
+// ConvertOptions is the options of Convert.
+type ConvertOptions struct {
+	// UptimeResolution is the duration to which "uptime" is truncated.
+	UptimeResolution time.Duration
+	// IDKind is the kind of ids for "user" and "group" like idKindEffective.
+	IDKind string
+	// MainPids is the main processes of services for "ismain".
+	MainPids []ServicePid
+	// Tasks is the value of "tasks" keyed by services.
+	Tasks map[string]string
+	// OnError is called with an error of getting the value of the field
+	// of the process, e.g. an overflow of a broken value, and the value is
+	// omitted. Convert returns the error if OnError is nil.
+	OnError func(pid int, field string, err error)
+}
+
+// Convert returns the values of fields of defs for each record keyed by
+// the names of fields, with the service name keyed by DataKeyService if it
+// is known. Values which are not available for the process are omitted.
+// Fields without Extract are ignored.
+func Convert(sysValCache *SysValueCache, defs []*FieldDef, records []ProcessRawRecord, opts ConvertOptions) ([]map[string]any, error) {
+	defs = slices.DeleteFunc(slices.Clone(defs), func(def *FieldDef) bool {
+		return def.Extract == nil
+	})
+	x, err := newExtractContext(sysValCache, defs, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	dataList := make([]map[string]any, len(records))
+	for i := range records {
+		record := &records[i]
+		data := make(map[string]any)
+		if record.Service != "" {
+			data[DataKeyService] = record.Service
+		}
+		for _, def := range defs {
+			value, ok, err := def.Extract(x, record)
+			if err != nil {
+				if opts.OnError == nil {
+					return nil, fmt.Errorf("cannot get %s of pid %d: %s", def.Name, record.Pid, err)
+				}
+				opts.OnError(record.Pid, def.Name, err)
+				continue
+			}
+			if ok {
+				data[def.Name] = value
+			}
+		}
+		dataList[i] = data
+	}
+
+	return dataList, nil
+}
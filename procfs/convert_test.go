@@ -0,0 +1,85 @@
+//go:build linux
+
+package procfs
+
+import (
+	"testing"
+	"time"
+)
+
+// newTestSysValueCache returns a SysValueCache with fixed values.
+func newTestSysValueCache(memTotal uint64) *SysValueCache {
+	return &SysValueCache{
+		GetBootTime:     func() (time.Time, error) { return time.Unix(1792164453, 0), nil },
+		GetSystemUptime: func() (time.Duration, error) { return 1000 * time.Second, nil },
+		GetPageSize:     func() (int, error) { return 4096, nil },
+		GetMemTotal:     func() (uint64, error) { return memTotal, nil },
+	}
+}
+
+func TestConvertPMEM(t *testing.T) {
+	def, _ := LookupFieldDef(FieldPMEM)
+	records := []ProcessRawRecord{{Pid: 1, RSS: RSS{raw: []byte("256")}}}
+
+	dataList, err := Convert(newTestSysValueCache(4*1024*1024), []*FieldDef{def}, records, ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dataList[0][FieldPMEM], Percent(25); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// pmem is missing instead of NaN or +Inf for zero MemTotal.
+	dataList, err = Convert(newTestSysValueCache(0), []*FieldDef{def}, records, ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, ok := dataList[0][FieldPMEM]; ok {
+		t.Errorf("got %v, want missing", got)
+	}
+}
+
+func TestConvertOnError(t *testing.T) {
+	def, _ := LookupFieldDef(FieldRSS)
+	records := []ProcessRawRecord{
+		{Pid: 1, RSS: RSS{raw: []byte("256")}},
+		// Bytes of this number of pages overflow.
+		{Pid: 2, RSS: RSS{raw: []byte("9223372036854775807")}},
+	}
+	if _, err := Convert(newTestSysValueCache(0), []*FieldDef{def}, records, ConvertOptions{}); err == nil {
+		t.Error("got no error without OnError")
+	}
+
+	var errPids []int
+	dataList, err := Convert(newTestSysValueCache(0), []*FieldDef{def}, records, ConvertOptions{
+		OnError: func(pid int, field string, err error) {
+			errPids = append(errPids, pid)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dataList[0][FieldRSS], uint64(256*4096); got != want {
+		t.Errorf("pid 1: got %v, want %v", got, want)
+	}
+	if got, ok := dataList[1][FieldRSS]; ok {
+		t.Errorf("pid 2: got %v, want missing", got)
+	}
+	if len(errPids) != 1 || errPids[0] != 2 {
+		t.Errorf("got errors of pids %v, want [2]", errPids)
+	}
+}
+
+func TestConvertStartNotInFuture(t *testing.T) {
+	setClkTck(t, 100)
+	def, _ := LookupFieldDef(FieldStart)
+	// The process started 0.5 seconds after the system uptime of 1000 seconds.
+	records := []ProcessRawRecord{{Pid: 1, StartTime: ClockTicks{raw: []byte("100050")}}}
+	dataList, err := Convert(newTestSysValueCache(0), []*FieldDef{def}, records, ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dataList[0][FieldStart].(time.Time), time.Unix(1792164453+1000, 0); !got.Equal(want) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}
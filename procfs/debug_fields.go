@@ -0,0 +1,47 @@
+//go:build linux
+
+package procfs
+
+func rawTicksExtractor(ticks func(r *ProcessRawRecord) ClockTicks) func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+	return func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+		n, err := ticks(r).AsTicks()
+		if err != nil {
+			return nil, false, err
+		}
+		return n, true, nil
+	}
+}
+
+// debugFieldDefs are fields of raw clock ticks in /proc/<pid>/stat, which
+// are used to verify "pcpu" and "uptime" against ps.
+var debugFieldDefs = []*FieldDef{
+	{
+		Name:    "utime",
+		Title:   "UTIME",
+		Type:    "integer",
+		Extract: rawTicksExtractor(func(r *ProcessRawRecord) ClockTicks { return r.UTime }),
+	},
+	{
+		Name:    "stime",
+		Title:   "STIME",
+		Type:    "integer",
+		Extract: rawTicksExtractor(func(r *ProcessRawRecord) ClockTicks { return r.STime }),
+	},
+	{
+		Name:    "starttime",
+		Title:   "STARTTIME",
+		Type:    "integer",
+		Extract: rawTicksExtractor(func(r *ProcessRawRecord) ClockTicks { return r.StartTime }),
+	},
+}
+
+// LookupDebugFieldDef returns the definition of the debug field "utime",
+// "stime", or "starttime" of raw clock ticks in /proc/<pid>/stat.
+func LookupDebugFieldDef(field string) (*FieldDef, bool) {
+	for _, def := range debugFieldDefs {
+		if def.Name == field {
+			return def, true
+		}
+	}
+	return nil, false
+}
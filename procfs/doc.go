@@ -0,0 +1,4 @@
+// Package procfs reads processes in /proc and converts them to typed values
+// of fields like "rss" and "uptime", which sdps shows as columns. It works
+// solely on Linux.
+package procfs
@@ -0,0 +1,595 @@
+//go:build linux
+
+package procfs
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Names of fields.
+const (
+	FieldPID      = "pid"
+	FieldPPID     = "ppid"
+	FieldPCPU     = "pcpu"
+	FieldPMEM     = "pmem"
+	FieldVSZ      = "vsz"
+	FieldRSS      = "rss"
+	FieldVSZPeak  = "vsz_peak"
+	FieldRSSPeak  = "rss_peak"
+	FieldRSSLim   = "rsslim"
+	FieldVolCS    = "volcs"
+	FieldNonVolCS = "nonvolcs"
+	FieldCPU      = "cpu"
+	FieldRTPrio   = "rtprio"
+	FieldPolicy   = "policy"
+	FieldStart    = "start"
+	FieldUptime   = "uptime"
+	FieldCommand  = "command"
+	FieldComm     = "comm"
+	FieldUser     = "user"
+	FieldGroup    = "group"
+	FieldListen   = "listen"
+	FieldIsMain   = "ismain"
+	FieldTasks    = "tasks"
+	FieldHost     = "host"
+	FieldBootID   = "bootid"
+)
+
+// sysValues is a set of system-wide values needed to extract field values.
+type sysValues uint8
+
+const (
+	sysPageSize sysValues = 1 << iota
+	sysMemTotal
+	sysBootTime
+	sysUptime
+	sysListeningSockets
+	sysHostname
+	sysBootID
+)
+
+// FieldDef is the metadata of a field which can be shown as a column.
+type FieldDef struct {
+	Name  string
+	Title string
+	// Type is the value type like "bytes" shown in help.
+	Type string
+	// Formatters are the template functions which can format the value.
+	Formatters []string
+	// StatIdx is the index in /proc/<pid>/stat of the value after rss
+	// needed for this field, or zero if none.
+	StatIdx int
+	// Status is true if this field needs /proc/<pid>/status.
+	Status bool
+	// Cmdline is true if this field needs /proc/<pid>/cmdline.
+	Cmdline bool
+	// Environ is true if this field needs /proc/<pid>/environ.
+	Environ bool
+	// SmapsRollup is true if this field needs /proc/<pid>/smaps_rollup.
+	SmapsRollup bool
+	// Sockets is true if this field needs sockets in /proc/<pid>/fd.
+	Sockets bool
+	// SysValues is the system-wide values needed for this field.
+	SysValues sysValues
+	// Extract returns the value of this field for the record.
+	// ok is false if the value is not available for the process.
+	Extract func(x *extractContext, r *ProcessRawRecord) (value any, ok bool, err error)
+}
+
+// extractContext holds system-wide values shared by all records.
+type extractContext struct {
+	pageSize         int
+	memTotal         uint64
+	bootTime         time.Time
+	sysUptime        time.Duration
+	uptimeResolution time.Duration
+	listeningSockets map[uint64]string
+	idIndex          int
+	userNames        *idNameCache
+	groupNames       *idNameCache
+	mainPids         map[ServicePid]bool
+	tasks            map[string]string
+	hostname         string
+	bootID           string
+}
+
+// FieldTypePercent is the type of Percent values.
+const FieldTypePercent = "percent"
+
+// Percent is a percentage value which is shown with one digit after
+// the decimal point by default, same as ps.
+type Percent float64
+
+func (p Percent) String() string {
+	return strconv.FormatFloat(float64(p), 'f', 1, 64)
+}
+
+var bytesFormatters = []string{"iBytes", "iBytesUnit"}
+
+// fieldDefs is all available fields in the order of the "all" columns.
+var fieldDefs = []*FieldDef{
+	{
+		Name:  FieldPID,
+		Title: "PID",
+		Type:  "integer",
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			return r.Pid, true, nil
+		},
+	},
+	{
+		Name:  FieldPPID,
+		Title: "PPID",
+		Type:  "integer",
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			return r.PPid, true, nil
+		},
+	},
+	{
+		Name:       FieldPCPU,
+		Title:      "%CPU",
+		Type:       FieldTypePercent,
+		Formatters: []string{"pct"},
+		SysValues:  sysUptime,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			procUptime, err := r.Uptime(x.sysUptime)
+			if err != nil {
+				return nil, false, err
+			}
+			pcpu, err := r.percentCPU(procUptime)
+			if err != nil {
+				return nil, false, err
+			}
+			return Percent(pcpu), true, nil
+		},
+	},
+	{
+		Name:       FieldPMEM,
+		Title:      "%MEM",
+		Type:       FieldTypePercent,
+		Formatters: []string{"pct"},
+		SysValues:  sysPageSize | sysMemTotal,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			if x.memTotal == 0 {
+				// The division would be NaN or +Inf, e.g. for a broken
+				// /proc/meminfo captured on another system.
+				return nil, false, nil
+			}
+			rssInBytes, err := r.RSS.InBytes(x.pageSize)
+			if err != nil {
+				return nil, false, err
+			}
+			return Percent(float64(rssInBytes) / float64(x.memTotal) * 100), true, nil
+		},
+	},
+	{
+		Name:       FieldVSZ,
+		Title:      "VSZ",
+		Type:       "bytes",
+		Formatters: bytesFormatters,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			vsizeInBytes, err := r.VSize.InBytes()
+			if err != nil {
+				return nil, false, err
+			}
+			return vsizeInBytes, true, nil
+		},
+	},
+	{
+		Name:       FieldRSS,
+		Title:      "RSS",
+		Type:       "bytes",
+		Formatters: bytesFormatters,
+		SysValues:  sysPageSize,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			rssInBytes, err := r.RSS.InBytes(x.pageSize)
+			if err != nil {
+				return nil, false, err
+			}
+			return rssInBytes, true, nil
+		},
+	},
+	{
+		Name:       FieldVSZPeak,
+		Title:      "VSZ_PEAK",
+		Type:       "bytes",
+		Formatters: bytesFormatters,
+		Status:     true,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			vmPeak, ok := r.Status.BytesValue("VmPeak")
+			return vmPeak, ok, nil
+		},
+	},
+	{
+		Name:       FieldRSSPeak,
+		Title:      "RSS_PEAK",
+		Type:       "bytes",
+		Formatters: bytesFormatters,
+		Status:     true,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			vmHWM, ok := r.Status.BytesValue("VmHWM")
+			return vmHWM, ok, nil
+		},
+	},
+	{
+		Name:       FieldRSSLim,
+		Title:      "RSSLIM",
+		Type:       "bytes",
+		Formatters: bytesFormatters,
+		StatIdx:    rssLimIdx,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			rssLim, err := r.RSSLim.InBytes()
+			if err != nil {
+				return nil, false, err
+			}
+			return rssLim, true, nil
+		},
+	},
+	{
+		Name:   FieldVolCS,
+		Title:  "VOLCS",
+		Type:   "integer",
+		Status: true,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			volCS, ok := r.Status.Uint64Value("voluntary_ctxt_switches")
+			return volCS, ok, nil
+		},
+	},
+	{
+		Name:   FieldNonVolCS,
+		Title:  "NONVOLCS",
+		Type:   "integer",
+		Status: true,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			nonVolCS, ok := r.Status.Uint64Value("nonvoluntary_ctxt_switches")
+			return nonVolCS, ok, nil
+		},
+	},
+	{
+		Name:    FieldCPU,
+		Title:   "CPU",
+		Type:    "integer",
+		StatIdx: processorIdx,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			cpu, err := r.Processor.AsInt()
+			if err != nil {
+				return nil, false, err
+			}
+			return cpu, true, nil
+		},
+	},
+	{
+		Name:    FieldRTPrio,
+		Title:   "RTPRIO",
+		Type:    "integer",
+		StatIdx: rtPriorityIdx,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			rtPrio, err := r.RTPriority.AsInt()
+			if err != nil {
+				return nil, false, err
+			}
+			return rtPrio, true, nil
+		},
+	},
+	{
+		Name:    FieldPolicy,
+		Title:   "POLICY",
+		Type:    "string",
+		StatIdx: policyIdx,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			return r.Policy.Name(), true, nil
+		},
+	},
+	{
+		Name:       FieldStart,
+		Title:      "START",
+		Type:       "time",
+		Formatters: []string{"format", "humanRelTime", "epoch"},
+		SysValues:  sysBootTime | sysUptime,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			// The start time is clamped to now in the same way as uptime.
+			procUptime, err := r.Uptime(x.sysUptime)
+			if err != nil {
+				return nil, false, err
+			}
+			return x.bootTime.Add(x.sysUptime - procUptime), true, nil
+		},
+	},
+	{
+		Name:       FieldUptime,
+		Title:      "UPTIME",
+		Type:       "duration",
+		Formatters: []string{"duration", "seconds"},
+		SysValues:  sysUptime,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			procUptime, err := r.Uptime(x.sysUptime)
+			if err != nil {
+				return nil, false, err
+			}
+			return procUptime.Truncate(x.uptimeResolution), true, nil
+		},
+	},
+	{
+		Name:       FieldCommand,
+		Title:      "COMMAND",
+		Type:       "string",
+		Formatters: []string{"argv"},
+		Cmdline:    true,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			return r.Command, true, nil
+		},
+	},
+	{
+		Name:  FieldComm,
+		Title: "COMM",
+		Type:  "string",
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			return r.Comm, true, nil
+		},
+	},
+	{
+		Name:   FieldUser,
+		Title:  "USER",
+		Type:   "string",
+		Status: true,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			uid, ok := statusID(r.Status, "Uid", x.idIndex)
+			if !ok {
+				return nil, false, nil
+			}
+			return x.userNames.Name(uid), true, nil
+		},
+	},
+	{
+		Name:   FieldGroup,
+		Title:  "GROUP",
+		Type:   "string",
+		Status: true,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			gid, ok := statusID(r.Status, "Gid", x.idIndex)
+			if !ok {
+				return nil, false, nil
+			}
+			return x.groupNames.Name(gid), true, nil
+		},
+	},
+	{
+		Name:      FieldListen,
+		Title:     "LISTEN",
+		Type:      "string",
+		Sockets:   true,
+		SysValues: sysListeningSockets,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			// SocketInodes is nil if /proc/<pid>/fd cannot be read.
+			if r.SocketInodes == nil {
+				return nil, false, nil
+			}
+			var addrs []string
+			for _, inode := range r.SocketInodes {
+				if addr, ok := x.listeningSockets[inode]; ok {
+					addrs = append(addrs, addr)
+				}
+			}
+			slices.Sort(addrs)
+			return strings.Join(slices.Compact(addrs), ","), true, nil
+		},
+	},
+	{
+		Name:  FieldIsMain,
+		Title: "ISMAIN",
+		Type:  "boolean",
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			if x.mainPids == nil {
+				return nil, false, nil
+			}
+			return x.mainPids[ServicePid{Service: r.Service, Pid: r.Pid}], true, nil
+		},
+	},
+	{
+		Name:      FieldHost,
+		Title:     "HOST",
+		Type:      "string",
+		SysValues: sysHostname,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			return x.hostname, x.hostname != "", nil
+		},
+	},
+	{
+		Name:      FieldBootID,
+		Title:     "BOOTID",
+		Type:      "string",
+		SysValues: sysBootID,
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			return x.bootID, x.bootID != "", nil
+		},
+	},
+	{
+		Name:  FieldTasks,
+		Title: "TASKS",
+		Type:  "string",
+		Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+			tasks, ok := x.tasks[r.Service]
+			return tasks, ok, nil
+		},
+	},
+}
+
+var fieldDefsByName = func() map[string]*FieldDef {
+	m := make(map[string]*FieldDef, len(fieldDefs))
+	for _, def := range fieldDefs {
+		m[def.Name] = def
+	}
+	return m
+}()
+
+// FieldDefs returns all available fields in the order of the "all" columns.
+func FieldDefs() []*FieldDef {
+	return fieldDefs
+}
+
+// ParamFieldDef is a parameterized field like "env:NODE_ENV" whose
+// definition is created from the argument after the prefix and ":".
+type ParamFieldDef struct {
+	Prefix string
+	// Arg is the placeholder of the argument shown in help.
+	Arg string
+	// Type and Formatters are shown in help.
+	Type       string
+	Formatters []string
+	// New returns the definition of the field for the argument.
+	New func(field, arg string) *FieldDef
+}
+
+// Name returns the field name with the placeholder like "env:<name>".
+func (p *ParamFieldDef) Name() string {
+	return p.Prefix + ":" + p.Arg
+}
+
+// ParamFieldDefs returns all parameterized fields.
+func ParamFieldDefs() []*ParamFieldDef {
+	return paramFieldDefs
+}
+
+var paramFieldDefs = []*ParamFieldDef{
+	{
+		Prefix: "env",
+		Arg:    "<name>",
+		Type:   "string",
+		New: func(field, name string) *FieldDef {
+			return &FieldDef{
+				Name:    field,
+				Title:   name,
+				Type:    "string",
+				Environ: true,
+				Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+					value, ok := r.Environ.Value(name)
+					return value, ok, nil
+				},
+			}
+		},
+	},
+	{
+		Prefix:     "smaps",
+		Arg:        "<key>",
+		Type:       "bytes",
+		Formatters: bytesFormatters,
+		New: func(field, key string) *FieldDef {
+			return &FieldDef{
+				Name:        field,
+				Title:       key,
+				Type:        "bytes",
+				Formatters:  bytesFormatters,
+				SmapsRollup: true,
+				Extract: func(x *extractContext, r *ProcessRawRecord) (any, bool, error) {
+					value, ok := r.SmapsRollup.BytesValue(key)
+					return value, ok, nil
+				},
+			}
+		},
+	},
+}
+
+// LookupFieldDef returns the definition of the field, including
+// parameterized fields which are created on demand.
+func LookupFieldDef(field string) (*FieldDef, bool) {
+	if def, ok := fieldDefsByName[field]; ok {
+		return def, true
+	}
+	if prefix, arg, ok := strings.Cut(field, ":"); ok && arg != "" {
+		for _, p := range paramFieldDefs {
+			if p.Prefix == prefix {
+				return p.New(field, arg), true
+			}
+		}
+	}
+	return nil, false
+}
+
+// AllFieldNames returns the names of all fields in FieldDefs.
+func AllFieldNames() []string {
+	names := make([]string, len(fieldDefs))
+	for i, def := range fieldDefs {
+		names[i] = def.Name
+	}
+	return names
+}
+
+// ReadOptionsOf returns the options for reading /proc/<pid> files which
+// are needed to extract the fields of defs.
+func ReadOptionsOf(defs []*FieldDef) ReadOptions {
+	opts := ReadOptions{StatMaxIdx: rssIdx}
+	for _, def := range defs {
+		opts.StatMaxIdx = max(opts.StatMaxIdx, def.StatIdx)
+		opts.Status = opts.Status || def.Status
+		opts.Cmdline = opts.Cmdline || def.Cmdline
+		opts.Environ = opts.Environ || def.Environ
+		opts.SmapsRollup = opts.SmapsRollup || def.SmapsRollup
+		opts.Sockets = opts.Sockets || def.Sockets
+	}
+	return opts
+}
+
+// newExtractContext gets the system-wide values needed for defs.
+func newExtractContext(sysValCache *SysValueCache, defs []*FieldDef, opts ConvertOptions) (*extractContext, error) {
+	var needs sysValues
+	for _, def := range defs {
+		needs |= def.SysValues
+	}
+
+	idIndex, ok := idKindIndexes[opts.IDKind]
+	if !ok {
+		idIndex = idKindIndexes[idKindEffective]
+	}
+	x := &extractContext{
+		uptimeResolution: opts.UptimeResolution,
+		idIndex:          idIndex,
+		userNames:        sysValCache.UserNames,
+		groupNames:       sysValCache.GroupNames,
+		tasks:            opts.Tasks,
+	}
+	if opts.MainPids != nil {
+		x.mainPids = make(map[ServicePid]bool, len(opts.MainPids))
+		for _, pid := range opts.MainPids {
+			x.mainPids[pid] = true
+		}
+	}
+	var err error
+	if needs&sysPageSize != 0 {
+		if x.pageSize, err = sysValCache.GetPageSize(); err != nil {
+			return nil, err
+		}
+	}
+	if needs&sysMemTotal != 0 {
+		if x.memTotal, err = sysValCache.GetMemTotal(); err != nil {
+			return nil, err
+		}
+	}
+	if needs&sysBootTime != 0 {
+		if x.bootTime, err = sysValCache.GetBootTime(); err != nil {
+			return nil, err
+		}
+	}
+	if needs&sysUptime != 0 {
+		if x.sysUptime, err = sysValCache.GetSystemUptime(); err != nil {
+			return nil, err
+		}
+	}
+	if needs&sysListeningSockets != 0 {
+		if x.listeningSockets, err = sysValCache.GetListeningSockets(); err != nil {
+			return nil, err
+		}
+	}
+	if needs&sysHostname != 0 {
+		if x.hostname, err = sysValCache.GetHostname(); err != nil {
+			return nil, err
+		}
+	}
+	if needs&sysBootID != 0 {
+		if x.bootID, err = sysValCache.GetBootID(); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package procfs
+
+import (
+	"os/user"
+	"strings"
+	"sync"
+)
+
+// idNameCache resolves uids or gids to names, looking up each id only once
+// since lookups may go through NSS and many processes share the same ids.
+type idNameCache struct {
+	lookup func(id string) (string, error)
+
+	mu    sync.Mutex
+	names map[string]string
+}
+
+func newUserNameCache() *idNameCache {
+	return &idNameCache{lookup: func(uid string) (string, error) {
+		u, err := user.LookupId(uid)
+		if err != nil {
+			return "", err
+		}
+		return u.Username, nil
+	}}
+}
+
+func newGroupNameCache() *idNameCache {
+	return &idNameCache{lookup: func(gid string) (string, error) {
+		g, err := user.LookupGroupId(gid)
+		if err != nil {
+			return "", err
+		}
+		return g.Name, nil
+	}}
+}
+
+// Name returns the name for the id, or the id itself if it cannot be
+// resolved, e.g. for a removed user or with SetRootDir where names of the
+// host are not relevant.
+func (c *idNameCache) Name(id string) string {
+	if IsOffline() {
+		return id
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if name, ok := c.names[id]; ok {
+		return name
+	}
+	name, err := c.lookup(id)
+	if err != nil {
+		name = id
+	}
+	if c.names == nil {
+		c.names = make(map[string]string)
+	}
+	c.names[id] = name
+	return name
+}
+
+const (
+	idKindReal      = "real"
+	idKindEffective = "effective"
+	idKindSaved     = "saved"
+	idKindFS        = "fs"
+)
+
+// idKindIndexes maps kinds of ids to indexes in the Uid and Gid lines of
+// /proc/<pid>/status, which list real, effective, saved set, and
+// filesystem ids.
+var idKindIndexes = map[string]int{
+	idKindReal:      0,
+	idKindEffective: 1,
+	idKindSaved:     2,
+	idKindFS:        3,
+}
+
+// statusID returns the id at index in the line for key like "Uid".
+func statusID(status ProcPidStatus, key string, index int) (string, bool) {
+	value, ok := status.value(key)
+	if !ok {
+		return "", false
+	}
+	ids := strings.Fields(string(value))
+	if len(ids) <= index {
+		return "", false
+	}
+	return ids[index], true
+}
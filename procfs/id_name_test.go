@@ -0,0 +1,67 @@
+//go:build linux
+
+package procfs
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+)
+
+// newCountingIDNameCache returns a cache whose lookup counts calls, and
+// fails for ids starting with "9" like a removed user.
+func newCountingIDNameCache(calls *int) *idNameCache {
+	return &idNameCache{lookup: func(id string) (string, error) {
+		*calls++
+		if id[0] == '9' {
+			return "", errors.New("unknown id")
+		}
+		return "user" + id, nil
+	}}
+}
+
+func TestIDNameCache(t *testing.T) {
+	var calls int
+	c := newCountingIDNameCache(&calls)
+	for range 3 {
+		if got, want := c.Name("1000"), "user1000"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		// An id which cannot be resolved is shown as is.
+		if got, want := c.Name("999"), "999"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("got %d lookups, want 2", calls)
+	}
+}
+
+func TestIDNameCacheOffline(t *testing.T) {
+	setFixtureRoot(t, nil)
+	var calls int
+	c := newCountingIDNameCache(&calls)
+	if got, want := c.Name("1000"), "1000"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if calls != 0 {
+		t.Errorf("got %d lookups, want none for names of another system", calls)
+	}
+}
+
+// BenchmarkIdNameCache resolves ids of many processes which share a few
+// users, where each id is looked up only once.
+func BenchmarkIdNameCache(b *testing.B) {
+	var calls int
+	c := newCountingIDNameCache(&calls)
+	ids := make([]string, 1000)
+	for i := range ids {
+		ids[i] = strconv.Itoa(1000 + i%10)
+	}
+	for b.Loop() {
+		for _, id := range ids {
+			c.Name(id)
+		}
+	}
+	b.ReportMetric(float64(calls), "lookups")
+}
@@ -0,0 +1,813 @@
+//go:build linux
+
+package procfs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/bits"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ServicePid is a pid of a process with the name of the service which
+// the process belongs to.
+type ServicePid struct {
+	Service string
+	Pid     int
+}
+
+type ProcessRawRecord struct {
+	Service    string
+	Pid        int
+	Comm       Comm
+	State      ProcState
+	PPid       PPid
+	Flags      ProcFlags
+	UTime      ClockTicks
+	STime      ClockTicks
+	StartTime  ClockTicks
+	VSize      VSize
+	RSS        RSS
+	RSSLim     RSSLim
+	Processor  Processor
+	RTPriority RTPriority
+	Policy     Policy
+	Command    Cmdline
+	Status     ProcPidStatus
+	Environ    ProcPidEnviron
+	// SmapsRollup is read for parameterized "smaps:<key>" fields.
+	SmapsRollup ProcPidSmapsRollup
+	// SocketInodes is nil if sockets are not read or cannot be read.
+	SocketInodes []uint64
+}
+
+// Uptime returns the elapsed time since the process started with the
+// system uptime. It is clamped to zero since the system uptime in
+// /proc/uptime has the precision of 10ms and the starttime in clock ticks is
+// truncated differently, so a process started just now can have a start
+// time slightly after the uptime.
+func (r *ProcessRawRecord) Uptime(sysUptime time.Duration) (time.Duration, error) {
+	startDur, err := r.StartTime.AsDuration()
+	if err != nil {
+		return 0, err
+	}
+	return max(sysUptime-startDur, 0), nil
+}
+
+func (r *ProcessRawRecord) percentCPU(procUptime time.Duration) (float64, error) {
+	uTimeTicks, err := r.UTime.AsTicks()
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert utime to integer: %s", err)
+	}
+	sTimeTicks, err := r.STime.AsTicks()
+	if err != nil {
+		return 0, fmt.Errorf("failed to convert stime to integer: %s", err)
+	}
+	uptimeTicks := durationToTicks(procUptime)
+	if uptimeTicks <= 0 {
+		// A process started within a clock tick has used no CPU time yet,
+		// and the division would be NaN or +Inf. The uptime can also be
+		// negative with skew between the system uptime and starttime.
+		return 0, nil
+	}
+	return float64(uTimeTicks+sTimeTicks) / float64(uptimeTicks) * 100, nil
+}
+
+// Sources of rss for ReadOptions.RSSSource.
+const (
+	// RSSSourceStat is rss in pages in /proc/<pid>/stat (fast but inaccurate).
+	RSSSourceStat = "stat"
+	// RSSSourceStatm is resident in pages in /proc/<pid>/statm.
+	RSSSourceStatm = "statm"
+	// RSSSourceSmaps is Rss in KiB in /proc/<pid>/smaps_rollup (accurate but slower).
+	RSSSourceSmaps = "smaps"
+)
+
+// ReadOptions specifies which files to read in addition to /proc/<pid>/stat.
+type ReadOptions struct {
+	// RSSSource is the source of rss like RSSSourceStat. An empty value
+	// means RSSSourceStat.
+	RSSSource string
+	// StatMaxIdx is the maximum index of fields to parse in /proc/<pid>/stat.
+	StatMaxIdx int
+	// Cmdline is true to read /proc/<pid>/cmdline.
+	Cmdline bool
+	// Status is true to read /proc/<pid>/status.
+	Status bool
+	// Environ is true to read /proc/<pid>/environ.
+	Environ bool
+	// SmapsRollup is true to read /proc/<pid>/smaps_rollup.
+	SmapsRollup bool
+	// Sockets is true to read inodes of sockets in /proc/<pid>/fd.
+	Sockets bool
+	// Timings is updated with elapsed times of reading files if not nil.
+	Timings *ReadTimings
+	// OnError is called with an error of reading an optional file of the
+	// process like "status" or "environ", whose values are shown as missing.
+	// The error is ignored if OnError is nil.
+	OnError func(pid int, file string, err error)
+}
+
+// ReadProcess reads files of the process of pid specified with opts.
+// It returns the first error of reading a required file, after which other
+// files are not read, e.g. since the process has exited.
+func ReadProcess(ctx context.Context, pid int, opts ReadOptions) (ProcessRawRecord, error) {
+	startTime := time.Now()
+	record, err := readProcPidStatWithRetry(ctx, pid, opts.StatMaxIdx)
+	if err == nil {
+		switch opts.RSSSource {
+		case RSSSourceStatm:
+			record.RSS, err = readProcPidStatmRSS(pid)
+		case RSSSourceSmaps:
+			record.RSS, err = readProcPidSmapsRollupRSS(pid)
+		}
+	}
+	opts.Timings.addStat(time.Since(startTime))
+	if err != nil {
+		return ProcessRawRecord{}, err
+	}
+
+	if opts.Cmdline {
+		startTime = time.Now()
+		record.Command, err = readProdPidCmdline(pid, record.Comm)
+		opts.Timings.addCmdline(time.Since(startTime))
+		if err != nil {
+			return ProcessRawRecord{}, err
+		}
+	}
+
+	if opts.Status {
+		// Some values in status are not available for some processes,
+		// so an error is only reported and those values are shown as missing.
+		var err error
+		if record.Status, err = readProcPidStatus(pid); err != nil && opts.OnError != nil {
+			opts.OnError(pid, "status", err)
+		}
+	}
+
+	if opts.Environ {
+		// environ of processes of other users cannot be read without
+		// privileges, so an error is only reported and values are shown as
+		// missing.
+		var err error
+		if record.Environ, err = readProcPidEnviron(pid); err != nil && opts.OnError != nil {
+			opts.OnError(pid, "environ", err)
+		}
+	}
+
+	if opts.SmapsRollup {
+		// smaps_rollup of processes of other users cannot be read without
+		// privileges, so an error is ignored and values are shown as missing.
+		record.SmapsRollup, _ = readProcPidSmapsRollup(pid)
+	}
+
+	if opts.Sockets {
+		// Likewise, the value is shown as missing if fds cannot be read.
+		record.SocketInodes, _ = readProcPidSocketInodes(pid)
+	}
+	return record, nil
+}
+
+// ProcPidEnviron is the content of /proc/<pid>/environ.
+type ProcPidEnviron struct {
+	raw []byte
+}
+
+func readProcPidEnviron(pid int) (ProcPidEnviron, error) {
+	filename := HostPath(fmt.Sprintf("/proc/%d/environ", pid))
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return ProcPidEnviron{}, fmt.Errorf("cannot read %s: %s", filename, err)
+	}
+	return ProcPidEnviron{raw: content}, nil
+}
+
+// Value returns the value of the environment variable name.
+func (e ProcPidEnviron) Value(name string) (string, bool) {
+	for entry := range bytes.SplitSeq(e.raw, []byte{'\x00'}) {
+		if key, value, ok := bytes.Cut(entry, []byte{'='}); ok && string(key) == name {
+			return string(value), true
+		}
+	}
+	return "", false
+}
+
+// ProcPidStatus is the content of /proc/<pid>/status.
+//
+// https://man7.org/linux/man-pages/man5/proc_pid_status.5.html
+type ProcPidStatus struct {
+	raw []byte
+}
+
+func readProcPidStatus(pid int) (ProcPidStatus, error) {
+	filename := HostPath(fmt.Sprintf("/proc/%d/status", pid))
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return ProcPidStatus{}, fmt.Errorf("cannot read %s: %s", filename, err)
+	}
+	return ProcPidStatus{raw: content}, nil
+}
+
+// BytesValue returns the value in bytes for the key whose line is
+// like "VmPeak:     1234 kB".
+func (s ProcPidStatus) BytesValue(key string) (uint64, bool) {
+	value, err := findKiBValue(s.raw, key+":")
+	if err != nil {
+		return 0, false
+	}
+	kib, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return kib * 1024, true
+}
+
+// Uint64Value returns the value for the key whose line is like
+// "voluntary_ctxt_switches:        150".
+func (s ProcPidStatus) Uint64Value(key string) (uint64, bool) {
+	value, ok := s.value(key)
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func (s ProcPidStatus) value(key string) ([]byte, bool) {
+	for line := range bytes.SplitSeq(s.raw, []byte{'\n'}) {
+		name, value, found := bytes.Cut(line, []byte{':'})
+		if found && string(name) == key {
+			return bytes.TrimSpace(value), true
+		}
+	}
+	return nil, false
+}
+
+// Comm is the command name in /proc/<pid>/stat without parentheses, which
+// is the filename of the executable truncated to 15 characters.
+type Comm struct {
+	raw []byte
+}
+
+func (c Comm) String() string {
+	return string(c.raw)
+}
+
+type ProcState struct {
+	raw []byte
+}
+
+func (s ProcState) String() string {
+	return string(s.raw)
+}
+
+type PPid struct {
+	raw []byte
+}
+
+func (p PPid) String() string {
+	return string(p.raw)
+}
+
+type ClockTicks struct {
+	raw []byte
+}
+
+func (t ClockTicks) AsTicks() (uint64, error) {
+	return strconv.ParseUint(string(t.raw), 10, 64)
+}
+
+func (t ClockTicks) AsDuration() (time.Duration, error) {
+	ticks, err := strconv.ParseUint(string(t.raw), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return TicksToDuration(ticks)
+}
+
+// TicksToDuration converts clock ticks to a duration. The whole seconds and
+// the remainder are converted separately, since time.Second/clkTck would be
+// truncated, or zero if clkTck is larger than MaxClkTck, and ticks*time.Second
+// would overflow.
+func TicksToDuration(ticks uint64) (time.Duration, error) {
+	hz := uint64(clkTck)
+	secs := ticks / hz
+	if secs >= math.MaxInt64/uint64(time.Second) {
+		return 0, fmt.Errorf("%d clock ticks is out of range of duration", ticks)
+	}
+	return time.Duration(secs)*time.Second + time.Duration(ticks%hz*uint64(time.Second)/hz), nil
+}
+
+// durationToTicks converts a duration to clock ticks rounded toward zero
+// in the same way as TicksToDuration. It does not overflow since clkTck is
+// not larger than MaxClkTck.
+func durationToTicks(d time.Duration) time.Duration {
+	hz := time.Duration(clkTck)
+	return d/time.Second*hz + d%time.Second*hz/time.Second
+}
+
+func (t ClockTicks) String() string {
+	return string(t.raw)
+}
+
+const (
+	// CLK_TCK is the number of clock ticks per second.
+	//
+	// CLK_TCK is a constant on Linux for all architectures except alpha and ia64.
+	// See e.g.
+	// https://git.musl-libc.org/cgit/musl/tree/src/conf/sysconf.c#n30
+	// https://github.com/containerd/cgroups/pull/12
+	// https://lore.kernel.org/lkml/agtlq6$iht$1@penguin.transmeta.com/
+	//
+	// copied from https://github.com/tklauser/go-sysconf/blob/v0.3.15/sysconf_linux.go#L18-L25
+	_SYSTEM_CLK_TCK = 100
+)
+
+// MaxClkTck is the maximum number of clock ticks per second for SetClkTck,
+// where a clock tick is a nanosecond.
+const MaxClkTck = int(time.Second)
+
+// clkTck is the number of clock ticks per second used for values in clock
+// ticks. It is _SYSTEM_CLK_TCK unless set with SetClkTck.
+var clkTck = _SYSTEM_CLK_TCK
+
+// SetClkTck sets the number of clock ticks per second, e.g. that of the
+// system of files captured for SetRootDir. Zero resets it to the default.
+// hz must not be negative nor larger than MaxClkTck.
+func SetClkTck(hz int) {
+	if hz == 0 {
+		hz = _SYSTEM_CLK_TCK
+	}
+	clkTck = hz
+}
+
+// ClkTck returns the number of clock ticks per second.
+func ClkTck() int {
+	return clkTck
+}
+
+type VSize struct {
+	raw []byte
+}
+
+func (s VSize) String() string {
+	return string(s.raw)
+}
+
+func (s VSize) InBytes() (uint64, error) {
+	return strconv.ParseUint(s.String(), 10, 64)
+}
+
+type RSS struct {
+	raw []byte
+	// inKiB is true when raw is in KiB (smaps_rollup) instead of pages.
+	inKiB bool
+}
+
+func (r RSS) String() string {
+	return string(r.raw)
+}
+
+// InPages returns the rss in pages. rss in /proc/<pid>/stat is signed
+// ("%ld") and may be reported as negative for some processes, so negative
+// values are clamped to zero instead of being errors.
+func (r RSS) InPages() (uint64, error) {
+	pages, err := strconv.ParseInt(r.String(), 10, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(max(pages, 0)), nil
+}
+
+func (r RSS) InBytes(pageSize int) (uint64, error) {
+	if r.inKiB {
+		kib, err := strconv.ParseUint(r.String(), 10, 64)
+		if err != nil {
+			return 0, err
+		}
+		hi, b := bits.Mul64(kib, 1024)
+		if hi != 0 {
+			return 0, fmt.Errorf("rss of %d KiB overflows in bytes", kib)
+		}
+		return b, nil
+	}
+	pageCount, err := r.InPages()
+	if err != nil {
+		return 0, err
+	}
+	hi, b := bits.Mul64(pageCount, uint64(pageSize))
+	if hi != 0 {
+		return 0, fmt.Errorf("rss of %d pages of %d bytes overflows in bytes", pageCount, pageSize)
+	}
+	return b, nil
+}
+
+func readProcPidStatmRSS(pid int) (RSS, error) {
+	// resident   (2) resident set size
+	//            (inaccurate; same as VmRSS in /proc/pid/status)
+	//
+	// https://man7.org/linux/man-pages/man5/proc_pid_statm.5.html
+	filename := HostPath(fmt.Sprintf("/proc/%d/statm", pid))
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return RSS{}, fmt.Errorf("cannot read %s: %w", filename, err)
+	}
+	fields := bytes.Fields(content)
+	const residentIdx = 1
+	if len(fields) <= residentIdx {
+		return RSS{}, fmt.Errorf("unexpected formatted content in %s: content=%s",
+			filename, string(content))
+	}
+	return RSS{raw: fields[residentIdx]}, nil
+}
+
+func readProcPidSmapsRollupRSS(pid int) (RSS, error) {
+	// Rss:                2584 kB
+	//
+	// https://man7.org/linux/man-pages/man5/proc_pid_smaps_rollup.5.html
+	filename := HostPath(fmt.Sprintf("/proc/%d/smaps_rollup", pid))
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return RSS{}, fmt.Errorf("cannot read %s: %w", filename, err)
+	}
+	value, err := findKiBValue(content, "Rss:")
+	if err != nil {
+		return RSS{}, fmt.Errorf("%s in %s", err, filename)
+	}
+	return RSS{raw: value, inKiB: true}, nil
+}
+
+// ProcPidSmapsRollup is the content of /proc/<pid>/smaps_rollup.
+//
+// https://man7.org/linux/man-pages/man5/proc_pid_smaps_rollup.5.html
+type ProcPidSmapsRollup struct {
+	raw []byte
+}
+
+func readProcPidSmapsRollup(pid int) (ProcPidSmapsRollup, error) {
+	filename := HostPath(fmt.Sprintf("/proc/%d/smaps_rollup", pid))
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return ProcPidSmapsRollup{}, fmt.Errorf("cannot read %s: %s", filename, err)
+	}
+	return ProcPidSmapsRollup{raw: content}, nil
+}
+
+// BytesValue returns the value in bytes for the key whose line is
+// like "Pss:     1234 kB".
+func (s ProcPidSmapsRollup) BytesValue(key string) (uint64, bool) {
+	return ProcPidStatus(s).BytesValue(key)
+}
+
+// findKiBValue returns the number in the line like "Rss:    2584 kB"
+// which starts with the specified key.
+func findKiBValue(content []byte, key string) ([]byte, error) {
+	for line := range bytes.SplitSeq(content, []byte{'\n'}) {
+		rest, found := bytes.CutPrefix(line, []byte(key))
+		if !found {
+			continue
+		}
+		fields := bytes.Fields(rest)
+		if len(fields) != 2 || string(fields[1]) != "kB" {
+			return nil, fmt.Errorf("unexpected formatted line: %s", string(line))
+		}
+		return fields[0], nil
+	}
+	return nil, fmt.Errorf("%s not found", key)
+}
+
+// procPidStatMaxRetries is the maximum number of retries for transient
+// errors in reading /proc/<pid>/stat, which may happen while the process
+// is exiting.
+const procPidStatMaxRetries = 2
+
+var errIncompleteProcPidStat = errors.New("cannot find starttime")
+
+func readProcPidStatWithRetry(ctx context.Context, pid int, maxIdx int) (ProcessRawRecord, error) {
+	record, err := readProcPidStat(pid, maxIdx)
+	for i := 0; i < procPidStatMaxRetries && err != nil && isTransientProcReadError(err); i++ {
+		if ctx.Err() != nil {
+			break
+		}
+		slog.Debug("retry reading stat", "pid", pid, "err", err)
+		record, err = readProcPidStat(pid, maxIdx)
+	}
+	return record, err
+}
+
+// isTransientProcReadError returns true for errors worth retrying.
+// Note ENOENT and ESRCH are not transient since they mean the process
+// has already exited.
+func isTransientProcReadError(err error) bool {
+	return errors.Is(err, errIncompleteProcPidStat) ||
+		errors.Is(err, syscall.EINVAL) ||
+		errors.Is(err, syscall.EAGAIN) ||
+		errors.Is(err, syscall.EINTR)
+}
+
+// readProcPidStat reads /proc/<pid>/stat and parses fields up to maxIdx
+// or rss whichever is later.
+func readProcPidStat(pid int, maxIdx int) (ProcessRawRecord, error) {
+	//  (1) pid  %d
+	//         The process ID.
+	//
+	//  ...(snip)...
+	//
+	//  (2) comm  %s
+	//         The filename of the executable, in parentheses.
+	//
+	//  (3) state  %c
+	//         One of the following characters, indicating process
+	//         state:
+	//
+	//         R      Running
+	//         S      Sleeping in an interruptible wait
+	//         D      Waiting in uninterruptible disk sleep
+	//         Z      Zombie
+	//         T      Stopped (on a signal)
+	//         t      Tracing stop
+	//         X      Dead
+	//         I      Idle
+	//
+	//  (4) ppid  %d
+	//         The PID of the parent of this process.
+	//
+	//  ...(snip)...
+	//
+	//  (14) utime  %lu
+	//         Amount of time that this process has been scheduled
+	//         in user mode, measured in clock ticks (divide by
+	//         sysconf(_SC_CLK_TCK)).  This includes guest time,
+	//         guest_time (time spent running a virtual CPU, see
+	//         below), so that applications that are not aware of
+	//         the guest time field do not lose that time from
+	//         their calculations.
+	//
+	//  (15) stime  %lu
+	//         Amount of time that this process has been scheduled
+	//         in kernel mode, measured in clock ticks (divide by
+	//         sysconf(_SC_CLK_TCK)).
+	//
+	//  ...(snip)...
+	//
+	//  (22) starttime  %llu
+	//         The time the process started after system boot.
+	//         Before Linux 2.6, this value was expressed in
+	//         jiffies.  Since Linux 2.6, the value is expressed in
+	//         clock ticks (divide by sysconf(_SC_CLK_TCK)).
+	//
+	//  (23) vsize  %lu
+	//         Virtual memory size in bytes.
+	//
+	//  (24) rss  %ld
+	//         Resident Set Size: number of pages the process has
+	//         in real memory.  This is just the pages which count
+	//         toward text, data, or stack space.  This does not
+	//         include pages which have not been demand-loaded in,
+	//         or which are swapped out.  This value is inaccurate;
+	//         see /proc/pid/statm below.
+	//
+	// https://man7.org/linux/man-pages/man5/proc_pid_stat.5.html
+	filename := HostPath(fmt.Sprintf("/proc/%d/stat", pid))
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return ProcessRawRecord{}, fmt.Errorf("cannot read %s: %w", filename, err)
+	}
+	// comm may contain spaces and parentheses, so split fields after
+	// the last ')'.
+	commEnd := bytes.LastIndexByte(content, ')')
+	if commEnd == -1 || commEnd+2 > len(content) {
+		return ProcessRawRecord{}, errIncompleteProcPidStat
+	}
+	fields := bytes.TrimSuffix(content[commEnd+2:], []byte{'\n'})
+	maxIdx = max(maxIdx, rssIdx)
+	i := stateIdx
+	record := ProcessRawRecord{Pid: pid}
+	if commStart := bytes.IndexByte(content, '('); commStart != -1 && commStart < commEnd {
+		record.Comm = Comm{raw: content[commStart+1 : commEnd]}
+	}
+	for word := range bytes.SplitSeq(fields, []byte{' '}) {
+		switch i {
+		case stateIdx:
+			record.State = ProcState{raw: word}
+		case ppidIdx:
+			record.PPid = PPid{raw: word}
+		case flagsIdx:
+			record.Flags = ProcFlags{raw: word}
+		case utimeIdx:
+			record.UTime = ClockTicks{raw: word}
+		case stimeIdx:
+			record.STime = ClockTicks{raw: word}
+		case startTimeIdx:
+			record.StartTime = ClockTicks{raw: word}
+		case vsizeIdx:
+			record.VSize = VSize{raw: word}
+		case rssIdx:
+			record.RSS = RSS{raw: word}
+		case rssLimIdx:
+			record.RSSLim = RSSLim{raw: word}
+		case processorIdx:
+			record.Processor = Processor{raw: word}
+		case rtPriorityIdx:
+			record.RTPriority = RTPriority{raw: word}
+		case policyIdx:
+			record.Policy = Policy{raw: word}
+		}
+		if i == maxIdx {
+			return record, nil
+		}
+		i++
+	}
+	return ProcessRawRecord{}, errIncompleteProcPidStat
+}
+
+// Indexes of fields in /proc/<pid>/stat. They are 1-origin same as
+// proc_pid_stat(5).
+const (
+	stateIdx      = 3
+	ppidIdx       = 4
+	flagsIdx      = 9
+	utimeIdx      = 14
+	stimeIdx      = 15
+	startTimeIdx  = 22
+	vsizeIdx      = 23
+	rssIdx        = 24
+	rssLimIdx     = 25
+	processorIdx  = 39
+	rtPriorityIdx = 40
+	policyIdx     = 41
+)
+
+// RSSLim is the current soft limit in bytes on the rss of the process.
+//
+//	(25) rsslim  %lu
+//	       Current soft limit in bytes on the rss of the
+//	       process; see the description of RLIMIT_RSS in
+//	       getrlimit(2).
+type RSSLim struct {
+	raw []byte
+}
+
+func (l RSSLim) String() string {
+	return string(l.raw)
+}
+
+// InBytes returns the limit in bytes, which is unlimitedBytes (the
+// maximum of uint64, i.e. RLIM_INFINITY) for unlimited.
+func (l RSSLim) InBytes() (uint64, error) {
+	return strconv.ParseUint(l.String(), 10, 64)
+}
+
+// Processor is the CPU number last executed on.
+//
+//	(39) processor  %d  (since Linux 2.2.8)
+//	       CPU number last executed on.
+type Processor struct {
+	raw []byte
+}
+
+func (p Processor) String() string {
+	return string(p.raw)
+}
+
+func (p Processor) AsInt() (int, error) {
+	return strconv.Atoi(p.String())
+}
+
+// RTPriority is the real-time scheduling priority of the process.
+//
+//	(40) rt_priority  %u  (since Linux 2.5.19)
+//	       Real-time scheduling priority, a number in the
+//	       range 1 to 99 for processes scheduled under a real-
+//	       time policy, or 0, for non-real-time processes (see
+//	       sched_setscheduler(2)).
+type RTPriority struct {
+	raw []byte
+}
+
+func (p RTPriority) String() string {
+	return string(p.raw)
+}
+
+func (p RTPriority) AsInt() (int, error) {
+	return strconv.Atoi(p.String())
+}
+
+// Policy is the scheduling policy of the process.
+//
+//	(41) policy  %u  (since Linux 2.5.19)
+//	       Scheduling policy (see sched_setscheduler(2)).
+//	       Decode using the SCHED_* constants in linux/sched.h.
+type Policy struct {
+	raw []byte
+}
+
+// policyNames is the names of SCHED_* constants in linux/sched.h same as
+// the "cls" column of ps.
+var policyNames = map[string]string{
+	"0": "TS",  // SCHED_OTHER
+	"1": "FF",  // SCHED_FIFO
+	"2": "RR",  // SCHED_RR
+	"3": "B",   // SCHED_BATCH
+	"4": "ISO", // SCHED_ISO
+	"5": "IDL", // SCHED_IDLE
+	"6": "DLN", // SCHED_DEADLINE
+}
+
+// Name returns the name of the policy like "TS", or "?" for an unknown one
+// same as ps.
+func (p Policy) Name() string {
+	if name, ok := policyNames[string(p.raw)]; ok {
+		return name
+	}
+	return "?"
+}
+
+func (p Policy) String() string {
+	return string(p.raw)
+}
+
+// ProcFlags is the kernel flags word of the process.
+//
+//	(9) flags  %u
+//	       The kernel flags word of the process.  For bit
+//	       meanings, see the PF_* defines in the Linux kernel
+//	       source file include/linux/sched.h.
+type ProcFlags struct {
+	raw []byte
+}
+
+// pfKthread is PF_KTHREAD in include/linux/sched.h, which is set for
+// kernel threads.
+const pfKthread = 0x00200000
+
+// IsKernelThread reports whether PF_KTHREAD is set in the flags.
+func (f ProcFlags) IsKernelThread() bool {
+	flags, err := strconv.ParseUint(string(f.raw), 10, 64)
+	return err == nil && flags&pfKthread != 0
+}
+
+func (f ProcFlags) String() string {
+	return string(f.raw)
+}
+
+// StatValue is a raw value in /proc/<pid>/stat.
+type StatValue struct {
+	raw []byte
+}
+
+func (v StatValue) String() string {
+	return string(v.raw)
+}
+
+type Cmdline struct {
+	raw []byte
+	// comm is used in place of raw when raw is empty, e.g. for kernel threads.
+	comm []byte
+}
+
+func (c Cmdline) String() string {
+	cmd := bytes.TrimRight(c.raw, "\x00")
+	if len(cmd) == 0 && len(c.comm) > 0 {
+		// Same as ps, show the command name in brackets.
+		return "[" + string(c.comm) + "]"
+	}
+	return string(bytes.ReplaceAll(cmd, []byte{'\x00'}, []byte{' '}))
+}
+
+// IsEmpty reports whether the command line is empty, e.g. for kernel threads.
+func (c Cmdline) IsEmpty() bool {
+	return len(bytes.TrimRight(c.raw, "\x00")) == 0
+}
+
+// Args returns the arguments separated by NUL characters. It returns an
+// empty slice for an empty command line.
+func (c Cmdline) Args() []string {
+	cmd := bytes.TrimRight(c.raw, "\x00")
+	if len(cmd) == 0 {
+		return []string{}
+	}
+	return strings.Split(string(cmd), "\x00")
+}
+
+// readProdPidCmdline reads the command line of the process with comm
+// read from /proc/<pid>/stat, which is used when the command line is empty.
+func readProdPidCmdline(pid int, comm Comm) (Cmdline, error) {
+	filename := HostPath(fmt.Sprintf("/proc/%d/cmdline", pid))
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return Cmdline{}, fmt.Errorf("cannot read %s: %w", filename, err)
+	}
+	return Cmdline{raw: content, comm: comm.raw}, nil
+}
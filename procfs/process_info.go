@@ -0,0 +1,165 @@
+//go:build linux
+
+package procfs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ProcessInfo is the typed values of a process for JSON, e.g. the output of
+// sdps with --typed. The default JSON output of sdps keeps values formatted
+// as shown in the table for compatibility with existing consumers, while
+// ProcessInfo is for programs which need numbers and times as they are.
+// Only fields of selected columns are set, and others are omitted.
+// Byte values are in bytes, uptime is in nanoseconds, and start is in
+// RFC 3339 format. CPURate and RSSRate are the changes per second since the
+// previous tick with --interval, which are set by sdps.
+type ProcessInfo struct {
+	// Time is the time when processes were read with --interval.
+	Time    string `json:"ts,omitempty"`
+	Service string `json:"service,omitempty"`
+	// Count is the number of deduplicated processes with --dedupe-by.
+	Count    *int              `json:"count,omitempty"`
+	PID      *int              `json:"pid,omitempty"`
+	PPID     *int              `json:"ppid,omitempty"`
+	PCPU     *float64          `json:"pcpu,omitempty"`
+	PMEM     *float64          `json:"pmem,omitempty"`
+	VSZ      *uint64           `json:"vsz,omitempty"`
+	RSS      *uint64           `json:"rss,omitempty"`
+	VSZPeak  *uint64           `json:"vsz_peak,omitempty"`
+	RSSPeak  *uint64           `json:"rss_peak,omitempty"`
+	RSSLim   *uint64           `json:"rsslim,omitempty"`
+	VolCS    *uint64           `json:"volcs,omitempty"`
+	NonVolCS *uint64           `json:"nonvolcs,omitempty"`
+	CPU      *int              `json:"cpu,omitempty"`
+	RTPrio   *int              `json:"rtprio,omitempty"`
+	Policy   *string           `json:"policy,omitempty"`
+	Start    *time.Time        `json:"start,omitempty"`
+	Uptime   *time.Duration    `json:"uptime,omitempty"`
+	Command  *string           `json:"command,omitempty"`
+	Comm     *string           `json:"comm,omitempty"`
+	User     *string           `json:"user,omitempty"`
+	Group    *string           `json:"group,omitempty"`
+	Listen   []string          `json:"listen,omitempty"`
+	IsMain   *bool             `json:"ismain,omitempty"`
+	Host     *string           `json:"host,omitempty"`
+	BootID   *string           `json:"bootid,omitempty"`
+	Tasks    *string           `json:"tasks,omitempty"`
+	CPURate  *float64          `json:"cpu_rate,omitempty"`
+	RSSRate  *int              `json:"rss_rate,omitempty"`
+	Env      map[string]string `json:"env,omitempty"`
+	Smaps    map[string]uint64 `json:"smaps,omitempty"`
+}
+
+// ProcessInfosOf returns ProcessInfo of the fields for each data returned
+// by Convert. Fields which are not in ProcessInfo are ignored.
+func ProcessInfosOf(fields []string, dataList []map[string]any) []ProcessInfo {
+	infos := make([]ProcessInfo, len(dataList))
+	for i, data := range dataList {
+		infos[i].Service, _ = data[DataKeyService].(string)
+		for _, field := range fields {
+			if value, ok := data[field]; ok && value != nil {
+				infos[i].set(field, value)
+			}
+		}
+	}
+	return infos
+}
+
+func (p *ProcessInfo) set(field string, value any) {
+	if prefix, arg, ok := strings.Cut(field, ":"); ok {
+		switch prefix {
+		case "env":
+			if p.Env == nil {
+				p.Env = make(map[string]string)
+			}
+			p.Env[arg] = fmt.Sprint(value)
+		case "smaps":
+			if v, ok := value.(uint64); ok {
+				if p.Smaps == nil {
+					p.Smaps = make(map[string]uint64)
+				}
+				p.Smaps[arg] = v
+			}
+		}
+		return
+	}
+
+	switch field {
+	case FieldPID:
+		p.PID = typedPtr[int](value)
+	case FieldPPID:
+		if ppid, err := strconv.Atoi(fmt.Sprint(value)); err == nil {
+			p.PPID = &ppid
+		}
+	case FieldPCPU:
+		p.PCPU = percentPtr(value)
+	case FieldPMEM:
+		p.PMEM = percentPtr(value)
+	case FieldVSZ:
+		p.VSZ = typedPtr[uint64](value)
+	case FieldRSS:
+		p.RSS = typedPtr[uint64](value)
+	case FieldVSZPeak:
+		p.VSZPeak = typedPtr[uint64](value)
+	case FieldRSSPeak:
+		p.RSSPeak = typedPtr[uint64](value)
+	case FieldRSSLim:
+		p.RSSLim = typedPtr[uint64](value)
+	case FieldVolCS:
+		p.VolCS = typedPtr[uint64](value)
+	case FieldNonVolCS:
+		p.NonVolCS = typedPtr[uint64](value)
+	case FieldCPU:
+		p.CPU = typedPtr[int](value)
+	case FieldRTPrio:
+		p.RTPrio = typedPtr[int](value)
+	case FieldPolicy:
+		p.Policy = typedPtr[string](value)
+	case FieldStart:
+		p.Start = typedPtr[time.Time](value)
+	case FieldUptime:
+		p.Uptime = typedPtr[time.Duration](value)
+	case FieldCommand:
+		command := fmt.Sprint(value)
+		p.Command = &command
+	case FieldComm:
+		comm := fmt.Sprint(value)
+		p.Comm = &comm
+	case FieldUser:
+		p.User = typedPtr[string](value)
+	case FieldGroup:
+		p.Group = typedPtr[string](value)
+	case FieldListen:
+		if s, ok := value.(string); ok && s != "" {
+			p.Listen = strings.Split(s, ",")
+		}
+	case FieldIsMain:
+		p.IsMain = typedPtr[bool](value)
+	case FieldHost:
+		p.Host = typedPtr[string](value)
+	case FieldBootID:
+		p.BootID = typedPtr[string](value)
+	case FieldTasks:
+		p.Tasks = typedPtr[string](value)
+	}
+}
+
+// typedPtr returns a pointer to value if it is of type T, or nil otherwise.
+func typedPtr[T any](value any) *T {
+	if v, ok := value.(T); ok {
+		return &v
+	}
+	return nil
+}
+
+func percentPtr(value any) *float64 {
+	if v, ok := value.(Percent); ok {
+		f := float64(v)
+		return &f
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+//go:build linux
+
+package procfs
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestProcessInfosOf(t *testing.T) {
+	dataList := []map[string]any{
+		{
+			DataKeyService: "foo",
+			FieldPID:       1,
+			FieldPPID:      PPid{raw: []byte("0")},
+			FieldPCPU:      Percent(1.5),
+			FieldRSS:       uint64(8192),
+			FieldUptime:    90 * time.Second,
+			FieldComm:      Comm{raw: []byte("bash")},
+			FieldListen:    "0.0.0.0:80,[::]:80",
+			"env:HOME":     "/root",
+			"smaps:Pss":    uint64(4096),
+		},
+		// Missing values are omitted.
+		{DataKeyService: "bar", FieldPID: 2, FieldRSS: nil},
+	}
+	fields := []string{FieldPID, FieldPPID, FieldPCPU, FieldRSS, FieldUptime, FieldComm,
+		FieldListen, "env:HOME", "smaps:Pss"}
+	got, err := json.Marshal(ProcessInfosOf(fields, dataList))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `[{"service":"foo","pid":1,"ppid":0,"pcpu":1.5,"rss":8192,"uptime":90000000000,"comm":"bash","listen":["0.0.0.0:80","[::]:80"],"env":{"HOME":"/root"},"smaps":{"Pss":4096}},` +
+		`{"service":"bar","pid":2}]`
+	if string(got) != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+}
@@ -0,0 +1,417 @@
+//go:build linux
+
+package procfs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// setClkTck sets the number of clock ticks per second until the end of
+// the test.
+func setClkTck(t *testing.T, hz int) {
+	t.Helper()
+	SetClkTck(hz)
+	t.Cleanup(func() { SetClkTck(0) })
+}
+
+func TestTicksToDuration(t *testing.T) {
+	testCases := []struct {
+		hz    int
+		ticks uint64
+		want  time.Duration
+	}{
+		{hz: 100, ticks: 0, want: 0},
+		{hz: 100, ticks: 7, want: 70 * time.Millisecond},
+		{hz: 100, ticks: 12345, want: 123450 * time.Millisecond},
+		// time.Second/hz would be truncated to 3ms.
+		{hz: 300, ticks: 1, want: 3333333 * time.Nanosecond},
+		{hz: 300, ticks: 300, want: time.Second},
+		{hz: MaxClkTck, ticks: 1, want: time.Nanosecond},
+		{hz: MaxClkTck, ticks: 1234567890, want: 1234567890 * time.Nanosecond},
+	}
+	for _, tc := range testCases {
+		setClkTck(t, tc.hz)
+		got, err := TicksToDuration(tc.ticks)
+		if err != nil {
+			t.Errorf("hz=%d, ticks=%d: %s", tc.hz, tc.ticks, err)
+		} else if got != tc.want {
+			t.Errorf("hz=%d, ticks=%d: got %s, want %s", tc.hz, tc.ticks, got, tc.want)
+		}
+	}
+}
+
+func TestTicksToDurationOutOfRange(t *testing.T) {
+	setClkTck(t, 100)
+	if got, err := TicksToDuration(1 << 63); err == nil {
+		t.Errorf("got %s, want an error", got)
+	}
+}
+
+func TestDurationToTicks(t *testing.T) {
+	testCases := []struct {
+		hz   int
+		d    time.Duration
+		want time.Duration
+	}{
+		{hz: 100, d: 9 * time.Millisecond, want: 0},
+		{hz: 100, d: 1234 * time.Millisecond, want: 123},
+		{hz: 300, d: 2 * time.Second, want: 600},
+		{hz: MaxClkTck, d: 1500 * time.Millisecond, want: 1500000000},
+		// It would overflow if the duration were multiplied first.
+		{hz: MaxClkTck, d: 200 * 365 * 24 * time.Hour, want: 200 * 365 * 24 * time.Hour},
+	}
+	for _, tc := range testCases {
+		setClkTck(t, tc.hz)
+		if got := durationToTicks(tc.d); got != tc.want {
+			t.Errorf("hz=%d, d=%s: got %d, want %d", tc.hz, tc.d, got, tc.want)
+		}
+	}
+}
+
+func TestPercentCPUWithLargeClkTck(t *testing.T) {
+	setClkTck(t, MaxClkTck)
+	r := &ProcessRawRecord{
+		UTime: ClockTicks{raw: []byte("500000000")},
+		STime: ClockTicks{raw: []byte("250000000")},
+	}
+	got, err := r.percentCPU(3 * time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := 25.0; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestReadProcPidStatKernelThread(t *testing.T) {
+	setFixtureRoot(t, map[string]string{
+		// kthreadd with PF_KTHREAD in flags 0x208040.
+		"/proc/2/stat": "2 (kthreadd) S 0 0 0 0 -1 2129984 0 0 0 0 0 0 0 0 20 0 1 0 7 0 0 18446744073709551615 0 0 0 0 0 0 0 2147483647 0 1 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+		// A user process with flags 0x400100.
+		"/proc/1/stat": "1 (process_api) S 0 0 0 0 -1 4194560 26202 12381 69 58 82 160 7 3 20 0 6 0 7 24072192 2239 18446744073709551615 1 1 0 0 0 0 0 4096 1088 0 0 0 17 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+	})
+	for pid, want := range map[int]bool{1: false, 2: true} {
+		record, err := readProcPidStat(pid, rssIdx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := record.Flags.IsKernelThread(); got != want {
+			t.Errorf("pid %d: got %v, want %v for flags %s", pid, got, want, record.Flags)
+		}
+	}
+}
+
+func TestReadProcPidStatSchedulingPolicy(t *testing.T) {
+	setFixtureRoot(t, map[string]string{
+		// A process with rt_priority 50 under SCHED_FIFO.
+		"/proc/1/stat": "1 (chronyd) S 0 0 0 0 -1 4194560 26202 12381 69 58 82 160 7 3 -51 0 6 0 7 24072192 2239 18446744073709551615 1 1 0 0 0 0 0 4096 1088 0 0 0 17 0 50 1 0 0 0 0 0 0 0 0 0 0 0\n",
+	})
+	record, err := readProcPidStat(1, policyIdx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := record.RTPriority.AsInt(); err != nil || got != 50 {
+		t.Errorf("got rtprio %d, %v, want 50", got, err)
+	}
+	if got, want := record.Policy.Name(), "FF"; got != want {
+		t.Errorf("got policy %q, want %q", got, want)
+	}
+}
+
+func TestPolicyName(t *testing.T) {
+	testCases := map[string]string{
+		"0": "TS", "1": "FF", "2": "RR", "3": "B", "5": "IDL", "6": "DLN", "7": "?", "": "?",
+	}
+	for raw, want := range testCases {
+		if got := (Policy{raw: []byte(raw)}).Name(); got != want {
+			t.Errorf("policy %q: got %q, want %q", raw, got, want)
+		}
+	}
+}
+
+func TestRSSInBytesNearMax(t *testing.T) {
+	const pageSize = 4096
+	maxPages := uint64(math.MaxUint64) / pageSize
+	rss := RSS{raw: []byte(strconv.FormatUint(maxPages, 10))}
+	got, err := rss.InBytes(pageSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := maxPages * pageSize; got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+
+	rss = RSS{raw: []byte(strconv.FormatUint(maxPages+1, 10))}
+	if got, err := rss.InBytes(pageSize); err == nil {
+		t.Errorf("got %d, want an overflow error", got)
+	}
+
+	rss = RSS{raw: []byte(strconv.FormatUint(math.MaxUint64/1024+1, 10)), inKiB: true}
+	if got, err := rss.InBytes(pageSize); err == nil {
+		t.Errorf("got %d, want an overflow error for KiB", got)
+	}
+}
+
+func TestProcessRawRecordUptime(t *testing.T) {
+	setClkTck(t, 100)
+	testCases := []struct {
+		startTime string
+		sysUptime time.Duration
+		want      time.Duration
+	}{
+		{startTime: "700", sysUptime: 100 * time.Second, want: 93 * time.Second},
+		{startTime: "10000", sysUptime: 100 * time.Second, want: 0},
+		// The start time in clock ticks can be slightly after the uptime.
+		{startTime: "10001", sysUptime: 100 * time.Second, want: 0},
+	}
+	for _, tc := range testCases {
+		r := &ProcessRawRecord{StartTime: ClockTicks{raw: []byte(tc.startTime)}}
+		got, err := r.Uptime(tc.sysUptime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("starttime %s, system uptime %s: got %s, want %s", tc.startTime, tc.sysUptime, got, tc.want)
+		}
+	}
+}
+
+func TestReadProcessStopsAtStatError(t *testing.T) {
+	// The process has exited, so neither stat nor cmdline exists.
+	setFixtureRoot(t, map[string]string{"/proc/stat": "btime 1792164453\n"})
+	_, err := ReadProcess(context.Background(), 1, ReadOptions{
+		StatMaxIdx: rssIdx,
+		RSSSource:  RSSSourceStatm,
+		Cmdline:    true,
+	})
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Fatalf("got %v, want an error of a missing file", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "/proc/1/stat") || strings.Contains(msg, "\n") {
+		t.Errorf("got %q, want only the error of stat", msg)
+	}
+}
+
+func TestReadProcessOnError(t *testing.T) {
+	stat := "1 (node) S"
+	for i := 4; i <= 52; i++ {
+		stat += " " + strconv.Itoa(i)
+	}
+	// status and environ of pid 1 cannot be read, e.g. without privileges.
+	setFixtureRoot(t, map[string]string{
+		"/proc/1/stat":    stat + "\n",
+		"/proc/2/stat":    strings.Replace(stat, "1 (node)", "2 (node)", 1) + "\n",
+		"/proc/2/status":  "Name:\tnode\n",
+		"/proc/2/environ": "HOME=/root\x00",
+	})
+	type readError struct {
+		pid  int
+		file string
+	}
+	var got []readError
+	opts := ReadOptions{
+		StatMaxIdx: rssIdx,
+		Status:     true,
+		Environ:    true,
+		OnError: func(pid int, file string, err error) {
+			if want := fmt.Sprintf("/proc/%d/%s", pid, file); !strings.Contains(err.Error(), want) {
+				t.Errorf("pid %d, %s: got %v, want an error of %s", pid, file, err, want)
+			}
+			got = append(got, readError{pid: pid, file: file})
+		},
+	}
+	for _, pid := range []int{1, 2} {
+		if _, err := ReadProcess(context.Background(), pid, opts); err != nil {
+			t.Errorf("pid %d: %s", pid, err)
+		}
+	}
+	if want := []readError{{pid: 1, file: "status"}, {pid: 1, file: "environ"}}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// Errors are ignored without OnError.
+	opts.OnError = nil
+	record, err := ReadProcess(context.Background(), 1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := record.Environ.Value("HOME"); ok {
+		t.Error("got HOME in environ which cannot be read")
+	}
+}
+
+func TestReadProdPidCmdline(t *testing.T) {
+	setFixtureRoot(t, map[string]string{
+		"/proc/1/cmdline": "node\x00server.js\x00",
+		// Kernel threads have an empty command line.
+		"/proc/2/cmdline": "",
+	})
+	testCases := []struct {
+		pid  int
+		comm string
+		want string
+		args []string
+	}{
+		{pid: 1, comm: "node", want: "node server.js", args: []string{"node", "server.js"}},
+		{pid: 2, comm: "kthreadd", want: "[kthreadd]", args: []string{}},
+		{pid: 2, want: "", args: []string{}},
+	}
+	for _, tc := range testCases {
+		cmdline, err := readProdPidCmdline(tc.pid, Comm{raw: []byte(tc.comm)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cmdline.String(); got != tc.want {
+			t.Errorf("pid %d, comm %q: got %q, want %q", tc.pid, tc.comm, got, tc.want)
+		}
+		if got := cmdline.Args(); !slices.Equal(got, tc.args) {
+			t.Errorf("pid %d, comm %q: got args %q, want %q", tc.pid, tc.comm, got, tc.args)
+		}
+		if got, want := cmdline.IsEmpty(), len(tc.args) == 0; got != want {
+			t.Errorf("pid %d, comm %q: got empty %v, want %v", tc.pid, tc.comm, got, want)
+		}
+	}
+
+	if _, err := readProdPidCmdline(3, Comm{}); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got %v, want an error of a missing file", err)
+	}
+}
+
+func TestReadProcessRSSSource(t *testing.T) {
+	setFixtureRoot(t, map[string]string{
+		"/proc/1/stat":         "1 (node) S 0 0 0 0 -1 4194560 0 0 0 0 82 160 0 0 20 0 1 0 7 24072192 2239 18446744073709551615 1 1 0 0 0 0 0 0 0 0 0 0 17 0 0 0\n",
+		"/proc/1/statm":        "5877 2300 1234 1 0 1000 0\n",
+		"/proc/1/smaps_rollup": "00400000-7ffd84ffe000 ---p 00000000 00:00 0                          [rollup]\nRss:                9308 kB\nPss:                5000 kB\n",
+	})
+	testCases := []struct {
+		source string
+		want   uint64
+	}{
+		{source: "", want: 2239 * 4096},
+		{source: RSSSourceStat, want: 2239 * 4096},
+		{source: RSSSourceStatm, want: 2300 * 4096},
+		// smaps_rollup is in KiB regardless of the page size.
+		{source: RSSSourceSmaps, want: 9308 * 1024},
+	}
+	for _, tc := range testCases {
+		record, err := ReadProcess(context.Background(), 1, ReadOptions{StatMaxIdx: rssIdx, RSSSource: tc.source})
+		if err != nil {
+			t.Fatalf("source %q: %s", tc.source, err)
+		}
+		got, err := record.RSS.InBytes(4096)
+		if err != nil {
+			t.Fatalf("source %q: %s", tc.source, err)
+		}
+		if got != tc.want {
+			t.Errorf("source %q: got %d, want %d", tc.source, got, tc.want)
+		}
+	}
+}
+
+// BenchmarkReadProcessCmdline shows the cost of reading /proc/<pid>/cmdline,
+// which is skipped unless columns like "command" need it.
+func BenchmarkReadProcessCmdline(b *testing.B) {
+	setFixtureRoot(b, fixtureProcess)
+	for _, cmdline := range []bool{false, true} {
+		b.Run(fmt.Sprintf("cmdline=%v", cmdline), func(b *testing.B) {
+			opts := ReadOptions{StatMaxIdx: rssIdx, Cmdline: cmdline}
+			for b.Loop() {
+				if _, err := ReadProcess(context.Background(), 1, opts); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestConvertCPUReadsProcessor(t *testing.T) {
+	// Each field after comm and state is its 1-based field number, so the
+	// value tells which field is read.
+	stat := "1 (node) S"
+	for i := 4; i <= 52; i++ {
+		stat += " " + strconv.Itoa(i)
+	}
+	setFixtureRoot(t, map[string]string{"/proc/1/stat": stat + "\n"})
+
+	def, _ := LookupFieldDef(FieldCPU)
+	record, err := ReadProcess(context.Background(), 1, ReadOptionsOf([]*FieldDef{def}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dataList, err := Convert(newTestSysValueCache(0), []*FieldDef{def}, []ProcessRawRecord{record}, ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// processor is field 39 in proc_pid_stat(5).
+	if got, want := dataList[0][FieldCPU], 39; got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestRSSNegative(t *testing.T) {
+	// rss in /proc/<pid>/stat is signed and may be negative.
+	rss := RSS{raw: []byte("-12")}
+	if got, err := rss.InPages(); err != nil || got != 0 {
+		t.Errorf("got %d pages, %v, want 0", got, err)
+	}
+	if got, err := rss.InBytes(4096); err != nil || got != 0 {
+		t.Errorf("got %d bytes, %v, want 0", got, err)
+	}
+
+	def, _ := LookupFieldDef(FieldRSS)
+	records := []ProcessRawRecord{{Pid: 1, RSS: rss}}
+	dataList, err := Convert(newTestSysValueCache(4*1024*1024), []*FieldDef{def}, records, ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dataList[0][FieldRSS], uint64(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestConvertPCPUStartedAtSystemUptime(t *testing.T) {
+	setClkTck(t, 100)
+	def, _ := LookupFieldDef(FieldPCPU)
+	// The process started at the system uptime of 1000 seconds in
+	// newTestSysValueCache, which is possible for a process started just now.
+	records := []ProcessRawRecord{{
+		Pid:       1,
+		UTime:     ClockTicks{raw: []byte("0")},
+		STime:     ClockTicks{raw: []byte("0")},
+		StartTime: ClockTicks{raw: []byte("100000")},
+	}}
+	dataList, err := Convert(newTestSysValueCache(0), []*FieldDef{def}, records, ConvertOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := dataList[0][FieldPCPU], Percent(0); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestPercentCPUWithoutPositiveUptime(t *testing.T) {
+	setClkTck(t, 100)
+	r := &ProcessRawRecord{
+		UTime: ClockTicks{raw: []byte("3")},
+		STime: ClockTicks{raw: []byte("1")},
+	}
+	// A process started within a clock tick, and uptimes skewed to negative.
+	for _, uptime := range []time.Duration{0, 5 * time.Millisecond, -time.Second} {
+		got, err := r.percentCPU(uptime)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != 0 {
+			t.Errorf("uptime %s: got %v, want 0 instead of NaN or Inf", uptime, got)
+		}
+	}
+}
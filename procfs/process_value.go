@@ -0,0 +1,47 @@
+//go:build linux
+
+package procfs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ProcessValue returns the typed value of the field for the process of pid.
+// The type of the value is int for "pid", "cpu", and "rtprio", PPid for
+// "ppid", Percent for "pcpu" and "pmem", uint64 in bytes for "vsz", "rss",
+// "vsz_peak", "rss_peak", "rsslim", and "smaps:<key>", uint64 for "volcs"
+// and "nonvolcs", time.Time for "start", time.Duration for "uptime",
+// Cmdline for "command", Comm for "comm", bool for "ismain", and string for
+// "policy", "user", "group", "listen", "host", "bootid", "tasks", and
+// "env:<name>".
+//
+// "start", "uptime", and "pcpu" require the system uptime in /proc/uptime
+// and "start" also requires the boot time in /proc/stat.
+// "rss" and "pmem" require the page size which is got by running
+// "getconf PAGESIZE", and "pmem" also requires MemTotal in /proc/meminfo.
+// "ismain" and "tasks" are not available since they need the service.
+func ProcessValue(ctx context.Context, pid int, field string) (any, error) {
+	def, ok := LookupFieldDef(field)
+	if !ok {
+		return nil, fmt.Errorf("invalid field: %s", field)
+	}
+	defs := []*FieldDef{def}
+	opts := ReadOptionsOf(defs)
+	opts.RSSSource = RSSSourceStat
+	record, err := ReadProcess(ctx, pid, opts)
+	if err != nil {
+		return nil, err
+	}
+	dataList, err := Convert(NewSysValueCache(ctx), defs, []ProcessRawRecord{record},
+		ConvertOptions{UptimeResolution: time.Second, IDKind: idKindEffective})
+	if err != nil {
+		return nil, err
+	}
+	value, ok := dataList[0][field]
+	if !ok {
+		return nil, fmt.Errorf("%s is not available for pid %d", field, pid)
+	}
+	return value, nil
+}
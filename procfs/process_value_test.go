@@ -0,0 +1,86 @@
+//go:build linux
+
+package procfs
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// fixtureProcess is the files of a process with pid 1 which was started
+// 0.07 seconds after the boot and has run for 833.25 seconds.
+var fixtureProcess = map[string]string{
+	"/proc/stat":           "cpu  14756 0 2581 65662 195 0 0 36 0 0\nbtime 1792164453\nprocesses 10519\n",
+	"/proc/uptime":         "833.32 656.62\n",
+	"/proc/1/stat":         "1 (process_api) S 0 0 0 0 -1 4194560 26202 12381 69 58 82 160 7 3 20 0 6 0 7 24072192 2239 18446744073709551615 1 1 0 0 0 0 0 4096 1088 0 0 0 17 0 0 0 0 0 0 0 0 0 0 0 0 0 0\n",
+	"/proc/1/cmdline":      "/process_api\x00--addr\x000.0.0.0:2024\x00",
+	"/proc/1/status":       "Name:\tprocess_api\nPid:\t1\nPPid:\t0\nUid:\t0\t0\t0\t0\nvoluntary_ctxt_switches:\t186\nnonvoluntary_ctxt_switches:\t52\n",
+	"/proc/1/environ":      "HOME=/root\x00NODE_ENV=prod\x00",
+	"/proc/1/smaps_rollup": "55d000000000-7ffd00000000 ---p 00000000 00:00 0    [rollup]\nRss:                9000 kB\nPss:                4000 kB\n",
+}
+
+func TestProcessValue(t *testing.T) {
+	setFixtureRoot(t, fixtureProcess)
+
+	testCases := []struct {
+		field string
+		want  any
+	}{
+		{field: FieldPID, want: 1},
+		{field: FieldPPID, want: PPid{raw: []byte("0")}},
+		{field: FieldComm, want: Comm{raw: []byte("process_api")}},
+		{field: FieldCPU, want: 0},
+		{field: FieldVSZ, want: uint64(24072192)},
+		{field: FieldVolCS, want: uint64(186)},
+		{field: FieldNonVolCS, want: uint64(52)},
+		{field: FieldStart, want: time.Unix(1792164453, 70_000_000)},
+		{field: FieldUptime, want: 833 * time.Second},
+		{field: "env:NODE_ENV", want: "prod"},
+		{field: "smaps:Pss", want: uint64(4000 * 1024)},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.field, func(t *testing.T) {
+			got, err := ProcessValue(context.Background(), 1, tc.field)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Compare types and formatted values since Comm and PPid
+			// have byte slices and time.Time has the location.
+			if g, w := fmt.Sprintf("%T %v", got, got), fmt.Sprintf("%T %v", tc.want, tc.want); g != w {
+				t.Errorf("got %s, want %s", g, w)
+			}
+		})
+	}
+}
+
+func TestProcessValueCommand(t *testing.T) {
+	setFixtureRoot(t, fixtureProcess)
+
+	got, err := ProcessValue(context.Background(), 1, FieldCommand)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdline, ok := got.(Cmdline)
+	if !ok {
+		t.Fatalf("got %T, want Cmdline", got)
+	}
+	if want := "/process_api --addr 0.0.0.0:2024"; cmdline.String() != want {
+		t.Errorf("got %q, want %q", cmdline.String(), want)
+	}
+}
+
+func TestProcessValueErrors(t *testing.T) {
+	setFixtureRoot(t, fixtureProcess)
+
+	if _, err := ProcessValue(context.Background(), 1, "bogus"); err == nil {
+		t.Error("got no error for an invalid field")
+	}
+	if _, err := ProcessValue(context.Background(), 1, FieldIsMain); err == nil {
+		t.Error("got no error for a field which needs the service")
+	}
+	if _, err := ProcessValue(context.Background(), 2, FieldPID); err == nil {
+		t.Error("got no error for a missing process")
+	}
+}
@@ -0,0 +1,31 @@
+//go:build linux
+
+package procfs
+
+import "path/filepath"
+
+// rootDir is the directory which mirrors "/" to read /proc and /sys
+// files from. It is set with SetRootDir for offline analysis of captured
+// files, and it is empty for the live system.
+var rootDir string
+
+// SetRootDir sets the directory which mirrors "/" of the analyzed system.
+// An empty dir means the live system.
+func SetRootDir(dir string) {
+	rootDir = dir
+}
+
+// HostPath returns the path of the file to read for the absolute path
+// on the analyzed system.
+func HostPath(path string) string {
+	if rootDir == "" {
+		return path
+	}
+	return filepath.Join(rootDir, path)
+}
+
+// IsOffline returns true when reading files captured from a system
+// instead of the live system, where systemctl cannot be used.
+func IsOffline() bool {
+	return rootDir != ""
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package procfs
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// setFixtureRoot writes files keyed by absolute paths like "/proc/1/stat"
+// into a temporary directory and sets it as the root directory until the
+// end of the test.
+func setFixtureRoot(t testing.TB, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for path, content := range files {
+		filename := filepath.Join(dir, path)
+		if err := os.MkdirAll(filepath.Dir(filename), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	SetRootDir(dir)
+	t.Cleanup(func() { SetRootDir("") })
+	return dir
+}
@@ -0,0 +1,131 @@
+//go:build linux
+
+package procfs
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// readProcPidSocketInodes returns inodes of sockets opened by the process.
+// Reading /proc/<pid>/fd of processes of other users requires privileges.
+func readProcPidSocketInodes(pid int) ([]uint64, error) {
+	dirname := HostPath(fmt.Sprintf("/proc/%d/fd", pid))
+	entries, err := os.ReadDir(dirname)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read %s: %s", dirname, err)
+	}
+	inodes := []uint64{}
+	for _, entry := range entries {
+		// The link is like "socket:[12345]". Fds closed after ReadDir are
+		// skipped.
+		link, err := os.Readlink(dirname + "/" + entry.Name())
+		if err != nil {
+			continue
+		}
+		inode, ok := strings.CutPrefix(link, "socket:[")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(strings.TrimSuffix(inode, "]"), 10, 64); err == nil {
+			inodes = append(inodes, n)
+		}
+	}
+	return inodes, nil
+}
+
+// listeningSocketStates is the state in /proc/net/<proto> of listening
+// sockets for each protocol. UDP sockets are "listening" when unconnected.
+var listeningSocketStates = []struct {
+	proto string
+	state string
+}{
+	{"tcp", "0A"},
+	{"tcp6", "0A"},
+	{"udp", "07"},
+	{"udp6", "07"},
+}
+
+// readListeningSockets returns addresses like "0.0.0.0:80/tcp" of listening
+// sockets keyed by inodes, which are read from /proc/net/{tcp,tcp6,udp,udp6}
+// in the network namespace of the current process. Files which do not
+// exist, e.g. without IPv6, are skipped.
+func readListeningSockets() (map[uint64]string, error) {
+	sockets := make(map[uint64]string)
+	for _, s := range listeningSocketStates {
+		filename := HostPath("/proc/net/" + s.proto)
+		slog.Debug("read file", "file", filename)
+		content, err := os.ReadFile(filename)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, fmt.Errorf("cannot read %s: %s", filename, err)
+		}
+		if err := parseNetSockets(content, s.proto, s.state, sockets); err != nil {
+			return nil, fmt.Errorf("%s in %s", err, filename)
+		}
+	}
+	return sockets, nil
+}
+
+// parseNetSockets adds sockets in state in the content of /proc/net/<proto>
+// to sockets. Lines are like the following, where the columns from
+// tx_queue to timeout are omitted:
+//
+//	sl  local_address rem_address   st ... inode
+//	 0: 00000000:0050 00000000:0000 0A ... 12345 ...
+func parseNetSockets(content []byte, proto, state string, sockets map[uint64]string) error {
+	for i, line := range bytes.Split(content, []byte{'\n'}) {
+		fields := strings.Fields(string(line))
+		if i == 0 || len(fields) == 0 {
+			continue
+		}
+		if len(fields) < 10 {
+			return fmt.Errorf("unexpected formatted line: %s", line)
+		}
+		if fields[3] != state {
+			continue
+		}
+		addr, err := parseNetAddress(fields[1])
+		if err != nil {
+			return err
+		}
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid inode: %s", fields[9])
+		}
+		sockets[inode] = addr + "/" + strings.TrimSuffix(proto, "6")
+	}
+	return nil
+}
+
+// parseNetAddress converts an address like "0100007F:0050" whose IP is
+// in 32-bit words of the host byte order (little endian) to "127.0.0.1:80".
+func parseNetAddress(s string) (string, error) {
+	ipHex, portHex, ok := strings.Cut(s, ":")
+	if !ok {
+		return "", fmt.Errorf("invalid address: %s", s)
+	}
+	ip, err := hex.DecodeString(ipHex)
+	if err != nil || (len(ip) != net.IPv4len && len(ip) != net.IPv6len) {
+		return "", fmt.Errorf("invalid address: %s", s)
+	}
+	for i := 0; i < len(ip); i += 4 {
+		slices.Reverse(ip[i : i+4])
+	}
+	port, err := strconv.ParseUint(portHex, 16, 16)
+	if err != nil {
+		return "", fmt.Errorf("invalid address: %s", s)
+	}
+	return net.JoinHostPort(net.IP(ip).String(), strconv.FormatUint(port, 10)), nil
+}
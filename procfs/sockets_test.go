@@ -0,0 +1,114 @@
+//go:build linux
+
+package procfs
+
+import (
+	"maps"
+	"testing"
+)
+
+const netTCPHeader = "  sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode\n"
+
+func TestParseNetSocketsTCP(t *testing.T) {
+	content := netTCPHeader +
+		"   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 12345 1 0000000000000000 100 0 0 10 0\n" +
+		"   1: 0100007F:1F90 00000000:0000 0A 00000000:00000000 00:00000000 00000000  1000        0 12346 1 0000000000000000 100 0 0 10 0\n" +
+		// An established connection is not listening.
+		"   2: 0100007F:1F90 0100007F:D431 01 00000000:00000000 00:00000000 00000000  1000        0 12347 1 0000000000000000 20 4 30 10 -1\n"
+	sockets := make(map[uint64]string)
+	if err := parseNetSockets([]byte(content), "tcp", "0A", sockets); err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]string{
+		12345: "0.0.0.0:80/tcp",
+		12346: "127.0.0.1:8080/tcp",
+	}
+	if !maps.Equal(sockets, want) {
+		t.Errorf("got %v, want %v", sockets, want)
+	}
+}
+
+func TestParseNetSocketsTCP6(t *testing.T) {
+	content := netTCPHeader +
+		"   0: 00000000000000000000000000000000:0016 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 22001 1 0000000000000000 100 0 0 10 0\n" +
+		"   1: 00000000000000000000000001000000:0277 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 22002 1 0000000000000000 100 0 0 10 0\n" +
+		// ::ffff:127.0.0.1, an IPv4-mapped IPv6 address.
+		"   2: 0000000000000000FFFF00000100007F:0050 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 22003 1 0000000000000000 100 0 0 10 0\n" +
+		// fe80::1
+		"   3: 000080FE000000000000000001000000:1F90 00000000000000000000000000000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 22004 1 0000000000000000 100 0 0 10 0\n"
+	// The sockets of tcp are kept.
+	sockets := map[uint64]string{12345: "0.0.0.0:80/tcp"}
+	if err := parseNetSockets([]byte(content), "tcp6", "0A", sockets); err != nil {
+		t.Fatal(err)
+	}
+	want := map[uint64]string{
+		12345: "0.0.0.0:80/tcp",
+		22001: "[::]:22/tcp",
+		22002: "[::1]:631/tcp",
+		22003: "127.0.0.1:80/tcp",
+		22004: "[fe80::1]:8080/tcp",
+	}
+	if !maps.Equal(sockets, want) {
+		t.Errorf("got %v, want %v", sockets, want)
+	}
+}
+
+func TestParseNetSocketsErrors(t *testing.T) {
+	testCases := []struct {
+		name string
+		line string
+	}{
+		{name: "short line", line: "   0: 00000000:0050 00000000:0000 0A\n"},
+		{name: "invalid address", line: "   0: 000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 12345\n"},
+		{name: "invalid inode", line: "   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 abc\n"},
+	}
+	for _, tc := range testCases {
+		if err := parseNetSockets([]byte(netTCPHeader+tc.line), "tcp", "0A", map[uint64]string{}); err == nil {
+			t.Errorf("%s: got no error", tc.name)
+		}
+	}
+}
+
+func TestParseNetAddress(t *testing.T) {
+	testCases := []struct {
+		s       string
+		want    string
+		wantErr bool
+	}{
+		{s: "0100007F:0050", want: "127.0.0.1:80"},
+		{s: "00000000:FFFF", want: "0.0.0.0:65535"},
+		{s: "0000000000000000FFFF00000100007F:0050", want: "127.0.0.1:80"},
+		{s: "00000000000000000000000001000000:0277", want: "[::1]:631"},
+		{s: "0100007F", wantErr: true},
+		{s: "0100007:0050", wantErr: true},
+		{s: "0100007F00:0050", wantErr: true},
+		{s: "ZZ00007F:0050", wantErr: true},
+		{s: "0100007F:10000", wantErr: true},
+	}
+	for _, tc := range testCases {
+		got, err := parseNetAddress(tc.s)
+		switch {
+		case tc.wantErr && err == nil:
+			t.Errorf("%q: got %q, want an error", tc.s, got)
+		case !tc.wantErr && err != nil:
+			t.Errorf("%q: %s", tc.s, err)
+		case got != tc.want:
+			t.Errorf("%q: got %q, want %q", tc.s, got, tc.want)
+		}
+	}
+}
+
+func TestReadListeningSockets(t *testing.T) {
+	// Without /proc/net/tcp6, udp, and udp6, e.g. without IPv6.
+	setFixtureRoot(t, map[string]string{
+		"/proc/net/tcp": netTCPHeader +
+			"   0: 00000000:0050 00000000:0000 0A 00000000:00000000 00:00000000 00000000     0        0 12345 1 0000000000000000 100 0 0 10 0\n",
+	})
+	sockets, err := readListeningSockets()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[uint64]string{12345: "0.0.0.0:80/tcp"}; !maps.Equal(sockets, want) {
+		t.Errorf("got %v, want %v", sockets, want)
+	}
+}
@@ -0,0 +1,210 @@
+//go:build linux
+
+package procfs
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type SysValueCache struct {
+	GetBootTime     func() (time.Time, error)
+	GetSystemUptime func() (time.Duration, error)
+	// GetIdleTime returns the sum of idle time of all CPUs.
+	GetIdleTime func() (time.Duration, error)
+	GetPageSize func() (int, error)
+	GetMemTotal func() (uint64, error)
+	// GetListeningSockets returns addresses of listening sockets keyed by inodes.
+	GetListeningSockets func() (map[uint64]string, error)
+	// GetHostname returns the host name of the system.
+	GetHostname func() (string, error)
+	// GetBootID returns the random id generated on each boot.
+	GetBootID func() (string, error)
+	// UserNames resolves uids to user names.
+	UserNames *idNameCache
+	// GroupNames resolves gids to group names.
+	GroupNames *idNameCache
+}
+
+func NewSysValueCache(ctx context.Context) *SysValueCache {
+	getUptimeValues := sync.OnceValues(readUptimeValues)
+	return &SysValueCache{
+		GetBootTime: sync.OnceValues(readBootTime),
+		GetSystemUptime: func() (time.Duration, error) {
+			values, err := getUptimeValues()
+			return values.uptime, err
+		},
+		GetIdleTime: func() (time.Duration, error) {
+			values, err := getUptimeValues()
+			return values.idle, err
+		},
+		GetPageSize: sync.OnceValues(func() (int, error) {
+			return getPageSize(ctx)
+		}),
+		GetMemTotal:         sync.OnceValues(readMemTotal),
+		GetListeningSockets: sync.OnceValues(readListeningSockets),
+		GetHostname: sync.OnceValues(func() (string, error) {
+			return readProcSysKernelValue("/proc/sys/kernel/hostname")
+		}),
+		GetBootID: sync.OnceValues(func() (string, error) {
+			return readProcSysKernelValue("/proc/sys/kernel/random/boot_id")
+		}),
+		UserNames:  newUserNameCache(),
+		GroupNames: newGroupNameCache(),
+	}
+}
+
+func readBootTime() (time.Time, error) {
+	filename := HostPath("/proc/stat")
+	// btime 769041601
+	//        boot time, in seconds since the Epoch, 1970-01-01
+	//        00:00:00 +0000 (UTC).
+	// https://man7.org/linux/man-pages/man5/proc_stat.5.html
+	slog.Debug("read file", "file", filename)
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("cannot read %s: %s", filename, err)
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	const btimePrefix = "btime "
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, btimePrefix) {
+			// Trim spaces and "\r" of CRLF in files captured on other systems.
+			btime, err := strconv.ParseInt(strings.TrimSpace(line[len(btimePrefix):]), 10, 64)
+			if err != nil {
+				return time.Time{}, fmt.Errorf("convert btime to int %s: %s", line, err)
+			}
+			return time.Unix(btime, 0), nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return time.Time{}, err
+	}
+	return time.Time{}, fmt.Errorf("btime not found in %s", filename)
+}
+
+// uptimeValues is the values in /proc/uptime.
+type uptimeValues struct {
+	// uptime is the uptime of the system including time spent in suspend.
+	uptime time.Duration
+	// idle is the sum of time spent in the idle process of all CPUs.
+	idle time.Duration
+}
+
+func readUptimeValues() (uptimeValues, error) {
+	filename := HostPath("/proc/uptime")
+	// This file contains two numbers (values in seconds): the
+	// uptime of the system (including time spent in suspend) and
+	// the amount of time spent in the idle process.
+	// https://man7.org/linux/man-pages/man5/proc_uptime.5.html
+	slog.Debug("read file", "file", filename)
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return uptimeValues{}, fmt.Errorf("cannot read %s: %s", filename, err)
+	}
+	values, err := parseUptimeValues(content)
+	if err != nil {
+		return uptimeValues{}, fmt.Errorf("%s in %s: content=%s", err, filename, string(content))
+	}
+	return values, nil
+}
+
+// parseUptimeValues parses the content of /proc/uptime like
+// "350735.47 234388.90\n". Whitespace around the values is ignored.
+func parseUptimeValues(content []byte) (uptimeValues, error) {
+	fields := strings.Fields(string(content))
+	if len(fields) != 2 {
+		return uptimeValues{}, errors.New("unexpected formatted content")
+	}
+	var secs [2]float64
+	for i, field := range fields {
+		var err error
+		if secs[i], err = strconv.ParseFloat(field, 64); err != nil {
+			return uptimeValues{}, fmt.Errorf("invalid uptime value %s", field)
+		}
+	}
+	return uptimeValues{
+		uptime: time.Duration(secs[0] * float64(time.Second)),
+		idle:   time.Duration(secs[1] * float64(time.Second)),
+	}, nil
+}
+
+// readProcSysKernelValue reads a single line value like the host name in
+// /proc/sys/kernel, which is read instead of os.Hostname to support SetRootDir.
+// It returns an empty string if the file does not exist, e.g. when it was not
+// captured for SetRootDir.
+// https://man7.org/linux/man-pages/man5/proc_sys_kernel.5.html
+func readProcSysKernelValue(path string) (string, error) {
+	filename := HostPath(path)
+	slog.Debug("read file", "file", filename)
+	content, err := os.ReadFile(filename)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("cannot read %s: %w", filename, err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+func getPageSize(ctx context.Context) (int, error) {
+	slog.Debug("run getconf PAGESIZE")
+	cmd := exec.CommandContext(ctx, "getconf", "PAGESIZE")
+	outputBytes, err := cmd.Output()
+	if err != nil {
+		return 0, CommandError(cmd, err)
+	}
+	return strconv.Atoi(string(bytes.TrimSuffix(outputBytes, []byte{'\n'})))
+}
+
+// CommandError returns an error for err of running cmd with its stderr,
+// which often explains the reason like permission or D-Bus failures.
+func CommandError(cmd *exec.Cmd, err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		return fmt.Errorf("%s: %w, stderr=%s", cmd, err, bytes.TrimSpace(exitErr.Stderr))
+	}
+	return fmt.Errorf("%s: %w", cmd, err)
+}
+
+func readMemTotal() (uint64, error) {
+	filename := HostPath("/proc/meminfo")
+	// MemTotal %lu
+	//        Total usable RAM (i.e., physical RAM minus a few
+	//        reserved bits and the kernel binary code).
+	// https://man7.org/linux/man-pages/man5/proc_meminfo.5.html
+	slog.Debug("read file", "file", filename)
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return 0, fmt.Errorf("cannot read %s: %s", filename, err)
+	}
+	memTotal, err := parseMemTotal(content)
+	if err != nil {
+		return 0, fmt.Errorf("%s in %s", err, filename)
+	}
+	return memTotal, nil
+}
+
+// parseMemTotal returns MemTotal in bytes from the content of /proc/meminfo.
+func parseMemTotal(content []byte) (uint64, error) {
+	value, err := findKiBValue(content, "MemTotal:")
+	if err != nil {
+		return 0, err
+	}
+	memTotalKiB, err := strconv.ParseUint(string(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("convert MemTotal to int %s: %s", string(value), err)
+	}
+	return memTotalKiB * 1024, nil
+}
@@ -0,0 +1,128 @@
+//go:build linux
+
+package procfs
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadProcSysKernelValue(t *testing.T) {
+	setFixtureRoot(t, map[string]string{
+		"/proc/sys/kernel/hostname": "vm\n",
+	})
+	got, err := readProcSysKernelValue("/proc/sys/kernel/hostname")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "vm"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	// A missing file is not an error, e.g. when it was not captured.
+	got, err = readProcSysKernelValue("/proc/sys/kernel/random/boot_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "" {
+		t.Errorf("got %q, want empty", got)
+	}
+}
+
+func TestProcessValueMissingBootID(t *testing.T) {
+	setFixtureRoot(t, fixtureProcess)
+	if got, err := ProcessValue(context.Background(), 1, FieldBootID); err == nil {
+		t.Errorf("got %q, want an error for a missing value", got)
+	}
+}
+
+func TestParseMemTotal(t *testing.T) {
+	got, err := parseMemTotal([]byte("MemTotal:        8039148 kB\nMemFree:          323544 kB\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := uint64(8039148 * 1024); got != want {
+		t.Errorf("got %d, want %d", got, want)
+	}
+
+	for _, content := range []string{
+		"MemFree:          323544 kB\n",
+		"MemTotal:        unknown kB\n",
+	} {
+		if got, err := parseMemTotal([]byte(content)); err == nil {
+			t.Errorf("parseMemTotal(%q) = %d, want an error", content, got)
+		}
+	}
+}
+
+func TestParseUptimeValues(t *testing.T) {
+	testCases := []struct {
+		content string
+		want    uptimeValues
+	}{
+		{content: "350735.47 234388.90\n", want: uptimeValues{uptime: 350735470 * time.Millisecond, idle: 234388900 * time.Millisecond}},
+		// The idle time is larger than the uptime on multi-processor systems.
+		{content: "833.32 3256.62\n", want: uptimeValues{uptime: 833320 * time.Millisecond, idle: 3256620 * time.Millisecond}},
+		{content: "  0.05   0.00\r\n", want: uptimeValues{uptime: 50 * time.Millisecond}},
+	}
+	for _, tc := range testCases {
+		got, err := parseUptimeValues([]byte(tc.content))
+		if err != nil {
+			t.Errorf("parseUptimeValues(%q): %s", tc.content, err)
+		} else if got.uptime.Round(time.Millisecond) != tc.want.uptime || got.idle.Round(time.Millisecond) != tc.want.idle {
+			t.Errorf("parseUptimeValues(%q) = %+v, want %+v", tc.content, got, tc.want)
+		}
+	}
+
+	for _, content := range []string{"", "350735.47\n", "350735.47 234388.90 1\n", "up 234388.90\n"} {
+		if got, err := parseUptimeValues([]byte(content)); err == nil {
+			t.Errorf("parseUptimeValues(%q) = %+v, want an error", content, got)
+		}
+	}
+}
+
+func TestReadBootTime(t *testing.T) {
+	testCases := []struct {
+		name    string
+		content string
+	}{
+		{name: "LF", content: "cpu  14756 0 2581 65662 195 0 0 36 0 0\nbtime 1792164453\nprocesses 10519\n"},
+		{name: "trailing spaces", content: "cpu  14756 0 2581 65662 195 0 0 36 0 0\nbtime 1792164453  \nprocesses 10519\n"},
+		// Files captured on Windows may have CRLF.
+		{name: "CRLF", content: "cpu  14756 0 2581 65662 195 0 0 36 0 0\r\nbtime 1792164453\r\nprocesses 10519\r\n"},
+		{name: "last line", content: "cpu  14756 0 2581 65662 195 0 0 36 0 0\nbtime 1792164453"},
+	}
+	for _, tc := range testCases {
+		setFixtureRoot(t, map[string]string{"/proc/stat": tc.content})
+		got, err := readBootTime()
+		if err != nil {
+			t.Errorf("%s: %s", tc.name, err)
+		} else if want := time.Unix(1792164453, 0); !got.Equal(want) {
+			t.Errorf("%s: got %s, want %s", tc.name, got, want)
+		}
+	}
+
+	for _, content := range []string{"cpu  14756 0 2581 65662 195 0 0 36 0 0\n", "btime now\n"} {
+		setFixtureRoot(t, map[string]string{"/proc/stat": content})
+		if got, err := readBootTime(); err == nil {
+			t.Errorf("content %q: got %s, want an error", content, got)
+		}
+	}
+}
+
+func TestCommandError(t *testing.T) {
+	cmd := exec.Command("/bin/sh", "-c", "echo 'getconf: Unrecognized variable' >&2; exit 1")
+	_, err := cmd.Output()
+	err = CommandError(cmd, err)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("got %v, want to wrap *exec.ExitError", err)
+	}
+	if !strings.HasSuffix(err.Error(), "stderr=getconf: Unrecognized variable") {
+		t.Errorf("got %q, want stderr of the command", err)
+	}
+}
@@ -0,0 +1,37 @@
+//go:build linux
+
+package procfs
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ReadTimings holds the total elapsed time of reading files per process.
+// It is updated atomically since files may be read concurrently.
+type ReadTimings struct {
+	stat    atomic.Int64
+	cmdline atomic.Int64
+}
+
+func (t *ReadTimings) addStat(d time.Duration) {
+	if t != nil {
+		t.stat.Add(int64(d))
+	}
+}
+
+func (t *ReadTimings) addCmdline(d time.Duration) {
+	if t != nil {
+		t.cmdline.Add(int64(d))
+	}
+}
+
+// Stat returns the total elapsed time of reading /proc/<pid>/stat.
+func (t *ReadTimings) Stat() time.Duration {
+	return time.Duration(t.stat.Load())
+}
+
+// Cmdline returns the total elapsed time of reading /proc/<pid>/cmdline.
+func (t *ReadTimings) Cmdline() time.Duration {
+	return time.Duration(t.cmdline.Load())
+}
@@ -0,0 +1,68 @@
+//go:build linux
+
+package main
+
+import (
+	"math"
+	"time"
+
+	"github.com/dustin/go-humanize"
+)
+
+// relTimeLang is the labels and formats of "humanRelTime" in a language.
+type relTimeLang struct {
+	ago, fromNow string
+	// magnitudes is nil to use the default English ones of humanize.
+	magnitudes []humanize.RelTimeMagnitude
+}
+
+// relTimeLangs is the languages of "humanRelTime" selectable with --lang.
+var relTimeLangs = map[string]relTimeLang{
+	"en": {ago: "ago", fromNow: "from now"},
+	"ja": {
+		ago:     "前",
+		fromNow: "後",
+		magnitudes: []humanize.RelTimeMagnitude{
+			{D: time.Second, Format: "今", DivBy: time.Second},
+			{D: time.Minute, Format: "%d秒%s", DivBy: time.Second},
+			{D: time.Hour, Format: "%d分%s", DivBy: time.Minute},
+			{D: humanize.Day, Format: "%d時間%s", DivBy: time.Hour},
+			{D: humanize.Week, Format: "%d日%s", DivBy: humanize.Day},
+			{D: humanize.Month, Format: "%d週間%s", DivBy: humanize.Week},
+			{D: humanize.Year, Format: "%dか月%s", DivBy: humanize.Month},
+			{D: humanize.LongTime, Format: "%d年%s", DivBy: humanize.Year},
+			{D: math.MaxInt64, Format: "ずっと%s", DivBy: 1},
+		},
+	},
+	"de": {
+		ago:     "vor",
+		fromNow: "in",
+		magnitudes: []humanize.RelTimeMagnitude{
+			{D: time.Second, Format: "jetzt", DivBy: time.Second},
+			{D: 2 * time.Second, Format: "%s 1 Sekunde", DivBy: 1},
+			{D: time.Minute, Format: "%s %d Sekunden", DivBy: time.Second},
+			{D: 2 * time.Minute, Format: "%s 1 Minute", DivBy: 1},
+			{D: time.Hour, Format: "%s %d Minuten", DivBy: time.Minute},
+			{D: 2 * time.Hour, Format: "%s 1 Stunde", DivBy: 1},
+			{D: humanize.Day, Format: "%s %d Stunden", DivBy: time.Hour},
+			{D: 2 * humanize.Day, Format: "%s 1 Tag", DivBy: 1},
+			{D: humanize.Week, Format: "%s %d Tagen", DivBy: humanize.Day},
+			{D: 2 * humanize.Week, Format: "%s 1 Woche", DivBy: 1},
+			{D: humanize.Month, Format: "%s %d Wochen", DivBy: humanize.Week},
+			{D: 2 * humanize.Month, Format: "%s 1 Monat", DivBy: 1},
+			{D: humanize.Year, Format: "%s %d Monaten", DivBy: humanize.Month},
+			{D: 18 * humanize.Month, Format: "%s 1 Jahr", DivBy: 1},
+			{D: 2 * humanize.Year, Format: "%s 2 Jahren", DivBy: 1},
+			{D: humanize.LongTime, Format: "%s %d Jahren", DivBy: humanize.Year},
+			{D: math.MaxInt64, Format: "%s langer Zeit", DivBy: 1},
+		},
+	},
+}
+
+// relTime formats then relative to now in the language like "3 minutes ago".
+func (l relTimeLang) relTime(then, now time.Time) string {
+	if l.magnitudes == nil {
+		return humanize.RelTime(then, now, l.ago, l.fromNow)
+	}
+	return humanize.CustomRelTime(then, now, l.ago, l.fromNow, l.magnitudes)
+}
@@ -0,0 +1,147 @@
+//go:build linux
+
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+type SortKey struct {
+	Field string
+	Desc  bool
+}
+
+// parseSortKeys parses specs like "rss" or "-rss" (descending) to SortKeys.
+func parseSortKeys(specs []string) ([]SortKey, error) {
+	keys := make([]SortKey, len(specs))
+	for i, spec := range specs {
+		field, desc := strings.CutPrefix(spec, "-")
+		if _, ok := lookupFieldDef(field); !ok {
+			return nil, fmt.Errorf("invalid sort field: %s", field)
+		}
+		keys[i] = SortKey{Field: field, Desc: desc}
+	}
+	return keys, nil
+}
+
+// sortKeyFields returns fields needed to sort by keys, which include pid
+// to break ties.
+func sortKeyFields(keys []SortKey) []string {
+	fields := make([]string, len(keys), len(keys)+1)
+	for i, key := range keys {
+		fields[i] = key.Field
+	}
+	return append(fields, fieldPID)
+}
+
+// sortDataList sorts dataList by typed values before they are rendered,
+// so that for example "start" is sorted by the exact start time even if
+// its format shows only minutes. Ties are broken by pid in ascending order
+// for deterministic output. Missing values come last in both orders.
+func sortDataList(dataList []map[string]any, keys []SortKey) {
+	slices.SortStableFunc(dataList, func(a, b map[string]any) int {
+		for _, key := range keys {
+			av, bv := a[key.Field], b[key.Field]
+			c := compareValues(av, bv)
+			if key.Desc && av != nil && bv != nil {
+				c = -c
+			}
+			if c != 0 {
+				return c
+			}
+		}
+		return compareValues(a[fieldPID], b[fieldPID])
+	})
+}
+
+// compareValues compares typed values in data. Strings are compared
+// in natural order so that "worker2" comes before "worker10".
+// Missing values come after any other values.
+func compareValues(a, b any) int {
+	if a == nil || b == nil {
+		switch {
+		case a != nil:
+			return -1
+		case b != nil:
+			return 1
+		default:
+			return 0
+		}
+	}
+	switch a := a.(type) {
+	case int:
+		return cmp.Compare(a, b.(int))
+	case uint64:
+		return cmp.Compare(a, b.(uint64))
+	case procfs.Percent:
+		return cmp.Compare(a, b.(procfs.Percent))
+	case time.Duration:
+		return cmp.Compare(a, b.(time.Duration))
+	case time.Time:
+		return a.Compare(b.(time.Time))
+	case bool:
+		return cmp.Compare(boolToInt(a), boolToInt(b.(bool)))
+	case fmt.Stringer:
+		return naturalCompare(a.String(), b.(fmt.Stringer).String())
+	case string:
+		return naturalCompare(a, b.(string))
+	default:
+		return 0
+	}
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// naturalCompare compares strings treating runs of digits as numbers.
+func naturalCompare(a, b string) int {
+	for a != "" && b != "" {
+		aDigits, bDigits := isDigit(a[0]), isDigit(b[0])
+		if aDigits != bDigits {
+			return strings.Compare(a, b)
+		}
+		var aChunk, bChunk string
+		if aDigits {
+			aChunk, a = cutLeadingFunc(a, isDigit)
+			bChunk, b = cutLeadingFunc(b, isDigit)
+			aNum := strings.TrimLeft(aChunk, "0")
+			bNum := strings.TrimLeft(bChunk, "0")
+			if c := cmp.Compare(len(aNum), len(bNum)); c != 0 {
+				return c
+			}
+			if c := strings.Compare(aNum, bNum); c != 0 {
+				return c
+			}
+		} else {
+			notDigit := func(c byte) bool { return !isDigit(c) }
+			aChunk, a = cutLeadingFunc(a, notDigit)
+			bChunk, b = cutLeadingFunc(b, notDigit)
+			if c := strings.Compare(aChunk, bChunk); c != 0 {
+				return c
+			}
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+func cutLeadingFunc(s string, f func(byte) bool) (leading, rest string) {
+	i := 0
+	for i < len(s) && f(s[i]) {
+		i++
+	}
+	return s[:i], s[i:]
+}
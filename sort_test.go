@@ -0,0 +1,131 @@
+//go:build linux
+
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+func TestNaturalCompare(t *testing.T) {
+	testCases := []struct {
+		a, b string
+		want int
+	}{
+		{a: "worker2", b: "worker10", want: -1},
+		{a: "worker10", b: "worker2", want: 1},
+		{a: "worker10", b: "worker10", want: 0},
+		// Leading zeros are ignored in numbers.
+		{a: "worker002", b: "worker10", want: -1},
+		{a: "v1.10.0", b: "v1.9.1", want: 1},
+		{a: "node", b: "node1", want: -1},
+		{a: "10", b: "9", want: 1},
+		{a: "a", b: "1", want: 1},
+		{a: "", b: "", want: 0},
+	}
+	for _, tc := range testCases {
+		if got := naturalCompare(tc.a, tc.b); got != tc.want {
+			t.Errorf("naturalCompare(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+}
+
+func TestSortDataListByStartWithinMinute(t *testing.T) {
+	minute := time.Date(2026, 10, 16, 9, 30, 0, 0, time.UTC)
+	dataList := []map[string]any{
+		{fieldPID: 1, fieldStart: minute.Add(45 * time.Second)},
+		{fieldPID: 2, fieldStart: minute.Add(5 * time.Second)},
+		{fieldPID: 3, fieldStart: minute.Add(30*time.Second + 10*time.Millisecond)},
+		{fieldPID: 4, fieldStart: minute.Add(30 * time.Second)},
+	}
+	sortDataList(dataList, []SortKey{{Field: fieldStart}})
+	if got, want := pidsOfDataList(dataList), []int{2, 4, 3, 1}; !slices.Equal(got, want) {
+		t.Errorf("got pids %v, want %v", got, want)
+	}
+
+	// All of them are shown as same with the default format of start.
+	columns, err := buildColumns(procfs.NewSysValueCache(context.Background()), []string{fieldStart},
+		map[string]string{fieldStart: `format "2006-01-02 15:04"`}, nil, alignRight, time.UTC, "en")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range dataList {
+		row, err := renderRow(columns, data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"2026-10-16 09:30"}; !slices.Equal(row, want) {
+			t.Errorf("got %q, want %q", row, want)
+		}
+	}
+}
+
+func pidsOfDataList(dataList []map[string]any) []int {
+	pids := make([]int, len(dataList))
+	for i, data := range dataList {
+		pids[i], _ = data[fieldPID].(int)
+	}
+	return pids
+}
+
+func TestSortDataListAllEqualKeys(t *testing.T) {
+	// Idle workers with the same pcpu and rss are ordered by pid.
+	newDataList := func(pids ...int) []map[string]any {
+		dataList := make([]map[string]any, len(pids))
+		for i, pid := range pids {
+			dataList[i] = map[string]any{fieldPID: pid, fieldPCPU: procfs.Percent(0), fieldRSS: uint64(4096)}
+		}
+		return dataList
+	}
+	for _, keys := range [][]SortKey{
+		{{Field: fieldPCPU}},
+		{{Field: fieldPCPU, Desc: true}},
+		{{Field: fieldPCPU, Desc: true}, {Field: fieldRSS}},
+	} {
+		for _, pids := range [][]int{{3, 1, 2, 10}, {10, 2, 1, 3}} {
+			dataList := newDataList(pids...)
+			sortDataList(dataList, keys)
+			if got, want := pidsOfDataList(dataList), []int{1, 2, 3, 10}; !slices.Equal(got, want) {
+				t.Errorf("keys %v, pids %v: got %v, want %v", keys, pids, got, want)
+			}
+		}
+	}
+
+	// Missing values come last, and are ordered by pid too.
+	dataList := []map[string]any{{fieldPID: 3}, {fieldPID: 2, fieldPCPU: procfs.Percent(1)}, {fieldPID: 1}}
+	sortDataList(dataList, []SortKey{{Field: fieldPCPU}})
+	if got, want := pidsOfDataList(dataList), []int{2, 1, 3}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestSortDataListMissingValuesLastInDescOrder(t *testing.T) {
+	// Processes whose rss could not be read, e.g. zombies.
+	newDataList := func() []map[string]any {
+		return []map[string]any{
+			{fieldPID: 4},
+			{fieldPID: 1, fieldRSS: uint64(4096)},
+			{fieldPID: 2},
+			{fieldPID: 3, fieldRSS: uint64(8192)},
+		}
+	}
+	testCases := []struct {
+		keys []SortKey
+		want []int
+	}{
+		{keys: []SortKey{{Field: fieldRSS}}, want: []int{1, 3, 2, 4}},
+		{keys: []SortKey{{Field: fieldRSS, Desc: true}}, want: []int{3, 1, 2, 4}},
+		{keys: []SortKey{{Field: fieldRSS, Desc: true}, {Field: fieldPID, Desc: true}}, want: []int{3, 1, 4, 2}},
+	}
+	for _, tc := range testCases {
+		dataList := newDataList()
+		sortDataList(dataList, tc.keys)
+		if got := pidsOfDataList(dataList); !slices.Equal(got, tc.want) {
+			t.Errorf("keys %v: got %v, want %v", tc.keys, got, tc.want)
+		}
+	}
+}
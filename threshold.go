@@ -0,0 +1,144 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dustin/go-humanize"
+	"github.com/hnakamur/sdps/procfs"
+)
+
+// Threshold keeps data whose numeric value of Field is at least Value,
+// or at most Value if Max is true.
+type Threshold struct {
+	Field string
+	Max   bool
+	Value float64
+}
+
+// parseThresholds parses values of --min and --max like "rss=100MiB" or
+// "pcpu=50". Sizes like "100MiB" or "1.5GB" are accepted for bytes fields,
+// and durations like "1d12h" for "uptime". It is an error if the minimum
+// of a field is greater than its maximum, since no data could match.
+func parseThresholds(mins, maxs map[string]string) ([]Threshold, error) {
+	var thresholds []Threshold
+	minValues := make(map[string]float64, len(mins))
+	for _, isMax := range []bool{false, true} {
+		specs := mins
+		if isMax {
+			specs = maxs
+		}
+		for _, field := range slices.Sorted(maps.Keys(specs)) {
+			value, err := parseThresholdValue(field, specs[field])
+			if err != nil {
+				return nil, err
+			}
+			if !isMax {
+				minValues[field] = value
+			} else if minValue, ok := minValues[field]; ok && minValue > value {
+				return nil, fmt.Errorf("--min %s=%s is greater than --max %s=%s",
+					field, mins[field], field, maxs[field])
+			}
+			thresholds = append(thresholds, Threshold{Field: field, Max: isMax, Value: value})
+		}
+	}
+	return thresholds, nil
+}
+
+func parseThresholdValue(field, s string) (float64, error) {
+	def, ok := lookupFieldDef(field)
+	if !ok || def == countFieldDef {
+		return 0, invalidFieldError(field)
+	}
+	switch def.Type {
+	case "bytes":
+		b, err := humanize.ParseBytes(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid size for %s: %s", field, s)
+		}
+		return float64(b), nil
+	case fieldTypeBytesRate:
+		// The rate may be negative, and may have the unit like "1MiB/s".
+		abs, neg := strings.CutPrefix(strings.TrimSuffix(s, "/s"), "-")
+		b, err := humanize.ParseBytes(abs)
+		if err != nil {
+			return 0, fmt.Errorf("invalid size per second for %s: %s", field, s)
+		}
+		if neg {
+			return -float64(b), nil
+		}
+		return float64(b), nil
+	case "integer", procfs.FieldTypePercent:
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number for %s: %s", field, s)
+		}
+		return v, nil
+	case "duration":
+		d, err := parseLongDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration for %s: %s", field, s)
+		}
+		return float64(d), nil
+	default:
+		return 0, fmt.Errorf("threshold is not supported for %s, which is not numeric", field)
+	}
+}
+
+// isNumericField reports whether values of the field can be compared with
+// thresholds.
+func isNumericField(def *procfs.FieldDef) bool {
+	switch def.Type {
+	case "bytes", fieldTypeBytesRate, "integer", procfs.FieldTypePercent, "duration":
+		return true
+	default:
+		return false
+	}
+}
+
+func thresholdFields(thresholds []Threshold) []string {
+	fields := make([]string, len(thresholds))
+	for i, t := range thresholds {
+		fields[i] = t.Field
+	}
+	return fields
+}
+
+// filterDataListWithThresholds returns data which satisfy all thresholds.
+// Data with missing values for thresholds are excluded.
+func filterDataListWithThresholds(dataList []map[string]any, thresholds []Threshold) []map[string]any {
+	return slices.DeleteFunc(dataList, func(data map[string]any) bool {
+		for _, t := range thresholds {
+			v, ok := numericValue(data[t.Field])
+			if !ok || (t.Max && v > t.Value) || (!t.Max && v < t.Value) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// numericValue returns the typed value in data as float64.
+func numericValue(value any) (float64, bool) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case procfs.Percent:
+		return float64(v), true
+	case time.Duration:
+		return float64(v), true
+	case procfs.PPid:
+		n, err := strconv.ParseFloat(v.String(), 64)
+		return n, err == nil
+	default:
+		return 0, false
+	}
+}
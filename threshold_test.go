@@ -0,0 +1,127 @@
+//go:build linux
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseThresholdValue(t *testing.T) {
+	testCases := []struct {
+		field string
+		input string
+		want  float64
+	}{
+		{field: fieldRSS, input: "100MiB", want: 100 * 1024 * 1024},
+		{field: fieldRSS, input: "1.5GB", want: 1.5e9},
+		{field: fieldRSS, input: "100 KiB", want: 100 * 1024},
+		{field: fieldRSS, input: "4096", want: 4096},
+		{field: fieldRSSRate, input: "1MiB/s", want: 1024 * 1024},
+		{field: fieldRSSRate, input: "-512KiB/s", want: -512 * 1024},
+		{field: fieldPCPU, input: "50", want: 50},
+		{field: fieldPCPU, input: "0.5", want: 0.5},
+		{field: fieldCPURate, input: "12.5", want: 12.5},
+		{field: fieldPID, input: "1", want: 1},
+		{field: fieldUptime, input: "1d12h", want: float64(36 * time.Hour)},
+		{field: fieldUptime, input: "90s", want: float64(90 * time.Second)},
+	}
+	for _, tc := range testCases {
+		got, err := parseThresholdValue(tc.field, tc.input)
+		if err != nil {
+			t.Errorf("%s=%s: %s", tc.field, tc.input, err)
+		} else if got != tc.want {
+			t.Errorf("%s=%s: got %v, want %v", tc.field, tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestParseThresholdValueErrors(t *testing.T) {
+	testCases := []struct {
+		field   string
+		input   string
+		wantErr string
+	}{
+		{field: "nosuchfield", input: "1", wantErr: "nosuchfield"},
+		{field: fieldCount, input: "1", wantErr: fieldCount},
+		{field: fieldComm, input: "nginx", wantErr: "not numeric"},
+		{field: fieldUser, input: "0", wantErr: "not numeric"},
+		{field: fieldStart, input: "1h", wantErr: "not numeric"},
+		{field: fieldRSS, input: "lots", wantErr: "invalid size for rss"},
+		{field: fieldRSS, input: "-1MiB", wantErr: "invalid size for rss"},
+		{field: fieldRSSRate, input: "fast/s", wantErr: "invalid size per second"},
+		{field: fieldPCPU, input: "50%", wantErr: "invalid number for pcpu"},
+		{field: fieldPID, input: "one", wantErr: "invalid number for pid"},
+		{field: fieldUptime, input: "1x", wantErr: "invalid duration for uptime"},
+	}
+	for _, tc := range testCases {
+		got, err := parseThresholdValue(tc.field, tc.input)
+		if err == nil {
+			t.Errorf("%s=%s: got %v, want an error", tc.field, tc.input, got)
+		} else if !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("%s=%s: error %q does not contain %q", tc.field, tc.input, err, tc.wantErr)
+		}
+	}
+}
+
+func TestParseThresholds(t *testing.T) {
+	got, err := parseThresholds(
+		map[string]string{fieldRSS: "100MiB", fieldPCPU: "10"},
+		map[string]string{fieldPCPU: "50", fieldUptime: "1d"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Minimums come first, each sorted by field.
+	want := []Threshold{
+		{Field: fieldPCPU, Value: 10},
+		{Field: fieldRSS, Value: 100 * 1024 * 1024},
+		{Field: fieldPCPU, Max: true, Value: 50},
+		{Field: fieldUptime, Max: true, Value: float64(24 * time.Hour)},
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+
+	// The same minimum and maximum matches exactly the value.
+	if _, err := parseThresholds(map[string]string{fieldPCPU: "50"}, map[string]string{fieldPCPU: "50.0"}); err != nil {
+		t.Errorf("min == max: %s", err)
+	}
+}
+
+func TestParseThresholdsErrors(t *testing.T) {
+	testCases := []struct {
+		mins    map[string]string
+		maxs    map[string]string
+		wantErr string
+	}{
+		{
+			mins:    map[string]string{fieldRSS: "1GiB"},
+			maxs:    map[string]string{fieldRSS: "100MiB"},
+			wantErr: "--min rss=1GiB is greater than --max rss=100MiB",
+		},
+		{
+			mins:    map[string]string{fieldUptime: "2d"},
+			maxs:    map[string]string{fieldUptime: "1d"},
+			wantErr: "--min uptime=2d is greater than --max uptime=1d",
+		},
+		{
+			maxs:    map[string]string{fieldPCPU: "high"},
+			wantErr: "invalid number for pcpu",
+		},
+		{
+			mins:    map[string]string{fieldComm: "a"},
+			wantErr: "not numeric",
+		},
+	}
+	for _, tc := range testCases {
+		got, err := parseThresholds(tc.mins, tc.maxs)
+		if err == nil {
+			t.Errorf("min=%v, max=%v: got %+v, want an error", tc.mins, tc.maxs, got)
+		} else if !strings.Contains(err.Error(), tc.wantErr) {
+			t.Errorf("min=%v, max=%v: error %q does not contain %q", tc.mins, tc.maxs, err, tc.wantErr)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+//go:build linux
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// whereExpr is a parsed --where expression like
+// `rss > 100MiB && (pcpu >= 10 || command == "nginx: worker process")`.
+//
+// Comparisons have a column on the left and a value on the right.
+// Values of numeric columns are parsed in the same way as --min and --max
+// and compared with <, <=, >, >=, ==, and !=. Values of other columns are
+// compared as strings with == and !=. Comparisons can be combined with
+// "&&", "||", "!", and parentheses. Processes with a missing value in a
+// comparison do not match it.
+type whereExpr interface {
+	eval(data map[string]any) bool
+}
+
+type whereAnd struct{ left, right whereExpr }
+
+func (e whereAnd) eval(data map[string]any) bool {
+	return e.left.eval(data) && e.right.eval(data)
+}
+
+type whereOr struct{ left, right whereExpr }
+
+func (e whereOr) eval(data map[string]any) bool {
+	return e.left.eval(data) || e.right.eval(data)
+}
+
+type whereNot struct{ expr whereExpr }
+
+func (e whereNot) eval(data map[string]any) bool {
+	return !e.expr.eval(data)
+}
+
+type whereCompare struct {
+	field string
+	op    string
+	// numeric is true to compare num, otherwise str.
+	numeric bool
+	num     float64
+	str     string
+}
+
+func (e whereCompare) eval(data map[string]any) bool {
+	value, ok := data[e.field]
+	if !ok || value == nil {
+		return false
+	}
+	if !e.numeric {
+		s := fmt.Sprint(value)
+		if e.op == "==" {
+			return s == e.str
+		}
+		return s != e.str
+	}
+	v, ok := numericValue(value)
+	if !ok {
+		return false
+	}
+	switch e.op {
+	case "<":
+		return v < e.num
+	case "<=":
+		return v <= e.num
+	case ">":
+		return v > e.num
+	case ">=":
+		return v >= e.num
+	case "==":
+		return v == e.num
+	default:
+		return v != e.num
+	}
+}
+
+// whereToken is a token of a --where expression. kind is the operator
+// itself for operators and parentheses.
+type whereToken struct {
+	kind string
+	text string
+	pos  int
+}
+
+const (
+	whereTokenWord   = "word"
+	whereTokenString = "string"
+	whereTokenEOF    = "end of expression"
+)
+
+var whereOperators = []string{"&&", "||", "<=", ">=", "==", "!=", "<", ">", "!", "(", ")"}
+
+func tokenizeWhere(s string) ([]whereToken, error) {
+	var tokens []whereToken
+	i := 0
+	for i < len(s) {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case c == '"':
+			end := i + 1
+			for end < len(s) && s[end] != '"' {
+				if s[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end >= len(s) {
+				return nil, fmt.Errorf("unterminated string at position %d", i)
+			}
+			text, err := strconv.Unquote(s[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("invalid string at position %d: %s", i, err)
+			}
+			tokens = append(tokens, whereToken{kind: whereTokenString, text: text, pos: i})
+			i = end + 1
+		default:
+			op := ""
+			for _, o := range whereOperators {
+				if strings.HasPrefix(s[i:], o) {
+					op = o
+					break
+				}
+			}
+			if op != "" {
+				tokens = append(tokens, whereToken{kind: op, text: op, pos: i})
+				i += len(op)
+				continue
+			}
+			end := i
+			for end < len(s) && !unicode.IsSpace(rune(s[end])) && !strings.ContainsRune(`"&|<>=!()`, rune(s[end])) {
+				end++
+			}
+			if end == i {
+				return nil, fmt.Errorf("unexpected character %q at position %d", s[i], i)
+			}
+			tokens = append(tokens, whereToken{kind: whereTokenWord, text: s[i:end], pos: i})
+			i = end
+		}
+	}
+	return append(tokens, whereToken{kind: whereTokenEOF, pos: len(s)}), nil
+}
+
+type whereParser struct {
+	tokens []whereToken
+	fields []string
+}
+
+// parseWhere parses s and returns the expression and fields in it.
+func parseWhere(s string) (whereExpr, []string, error) {
+	tokens, err := tokenizeWhere(s)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --where expression: %s", err)
+	}
+	p := &whereParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err == nil && p.peek().kind != whereTokenEOF {
+		err = p.unexpected()
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid --where expression: %s", err)
+	}
+	return expr, p.fields, nil
+}
+
+func (p *whereParser) peek() whereToken {
+	return p.tokens[0]
+}
+
+func (p *whereParser) next() whereToken {
+	t := p.tokens[0]
+	if t.kind != whereTokenEOF {
+		p.tokens = p.tokens[1:]
+	}
+	return t
+}
+
+func (p *whereParser) unexpected() error {
+	t := p.peek()
+	if t.kind == whereTokenEOF {
+		return fmt.Errorf("unexpected %s", t.kind)
+	}
+	return fmt.Errorf("unexpected %q at position %d", t.text, t.pos)
+}
+
+func (p *whereParser) parseOr() (whereExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = whereOr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseAnd() (whereExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().kind == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = whereAnd{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *whereParser) parseUnary() (whereExpr, error) {
+	switch p.peek().kind {
+	case "!":
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return whereNot{expr: expr}, nil
+	case "(":
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek().kind != ")" {
+			return nil, p.unexpected()
+		}
+		p.next()
+		return expr, nil
+	default:
+		return p.parseCompare()
+	}
+}
+
+func (p *whereParser) parseCompare() (whereExpr, error) {
+	if p.peek().kind != whereTokenWord {
+		return nil, p.unexpected()
+	}
+	fieldToken := p.next()
+	field := fieldToken.text
+	def, ok := lookupFieldDef(field)
+	if !ok || def == countFieldDef {
+		return nil, invalidFieldError(field)
+	}
+
+	opToken := p.peek()
+	switch opToken.kind {
+	case "<", "<=", ">", ">=", "==", "!=":
+		p.next()
+	default:
+		return nil, p.unexpected()
+	}
+	valueToken := p.peek()
+	if valueToken.kind != whereTokenWord && valueToken.kind != whereTokenString {
+		return nil, p.unexpected()
+	}
+	p.next()
+
+	p.fields = append(p.fields, field)
+	expr := whereCompare{field: field, op: opToken.kind}
+	switch {
+	case isNumericField(def):
+		num, err := parseThresholdValue(field, valueToken.text)
+		if err != nil {
+			return nil, fmt.Errorf("%s at position %d", err, valueToken.pos)
+		}
+		expr.numeric = true
+		expr.num = num
+	case def.Type == "string":
+		if opToken.kind != "==" && opToken.kind != "!=" {
+			return nil, fmt.Errorf("operator %s is not supported for %s, which is not numeric, at position %d",
+				opToken.kind, field, opToken.pos)
+		}
+		expr.str = valueToken.text
+	default:
+		return nil, fmt.Errorf("comparison is not supported for %s at position %d", field, fieldToken.pos)
+	}
+	return expr, nil
+}
@@ -0,0 +1,122 @@
+//go:build linux
+
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hnakamur/sdps/procfs"
+)
+
+func TestParseWhereEval(t *testing.T) {
+	master := map[string]any{
+		fieldPID: 1, fieldRSS: uint64(50 * 1024 * 1024), fieldPCPU: procfs.Percent(0.5),
+		fieldUser: "root", fieldCommand: "nginx: master process",
+	}
+	worker := map[string]any{
+		fieldPID: 2, fieldRSS: uint64(200 * 1024 * 1024), fieldPCPU: procfs.Percent(12),
+		fieldUser: "www-data", fieldCommand: "nginx: worker process",
+	}
+	// A process whose rss and user cannot be read.
+	unreadable := map[string]any{fieldPID: 3, fieldPCPU: procfs.Percent(0), fieldCommand: `say "hi"`}
+
+	testCases := []struct {
+		expr       string
+		wantFields []string
+		want       []bool // for master, worker, and unreadable
+	}{
+		{expr: "rss > 100MiB", wantFields: []string{fieldRSS}, want: []bool{false, true, false}},
+		{expr: "rss <= 50MiB", want: []bool{true, false, false}},
+		{expr: "pcpu >= 12", want: []bool{false, true, false}},
+		{expr: "pid == 1", want: []bool{true, false, false}},
+		{expr: "pid != 1", want: []bool{false, true, true}},
+		{expr: `user == "root"`, want: []bool{true, false, false}},
+		{expr: "user == root", want: []bool{true, false, false}},
+		// A missing value does not match even with !=.
+		{expr: `user != "root"`, want: []bool{false, true, false}},
+		{expr: `!(user == "root")`, want: []bool{false, true, true}},
+		{expr: `command == "say \"hi\""`, want: []bool{false, false, true}},
+		{expr: `command == "nginx: worker process"`, want: []bool{false, true, false}},
+		// && binds tighter than ||.
+		{expr: "pid == 3 || pid == 2 && pcpu < 1", wantFields: []string{fieldPID, fieldPID, fieldPCPU}, want: []bool{false, false, true}},
+		{expr: "(pid == 3 || pid == 2) && pcpu < 1", want: []bool{false, false, true}},
+		{expr: "pid == 1 || pid == 2 && pcpu > 1", want: []bool{true, true, false}},
+		{expr: "(pid == 1 || pid == 2) && pcpu > 1", want: []bool{false, true, false}},
+		{expr: "!pid == 1 && !(pcpu > 1)", want: []bool{false, false, true}},
+		{expr: "!!(pid == 1)", want: []bool{true, false, false}},
+		{expr: "pid==1||pid==2", want: []bool{true, true, false}},
+	}
+	for _, tc := range testCases {
+		expr, fields, err := parseWhere(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %s", tc.expr, err)
+			continue
+		}
+		if tc.wantFields != nil && !slices.Equal(fields, tc.wantFields) {
+			t.Errorf("%s: got fields %q, want %q", tc.expr, fields, tc.wantFields)
+		}
+		for i, data := range []map[string]any{master, worker, unreadable} {
+			if got := expr.eval(data); got != tc.want[i] {
+				t.Errorf("%s: got %v for pid %d, want %v", tc.expr, got, data[fieldPID], tc.want[i])
+			}
+		}
+	}
+}
+
+func TestParseWhereTypeMismatch(t *testing.T) {
+	// A value of an unexpected type does not match instead of a panic.
+	expr, _, err := parseWhere("rss > 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.eval(map[string]any{fieldRSS: "1GiB"}) {
+		t.Error("got a match for a string value of a numeric column")
+	}
+
+	expr, _, err = parseWhere("uptime > 1h")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expr.eval(map[string]any{fieldUptime: 2 * time.Hour}) {
+		t.Error("got no match for a longer uptime")
+	}
+}
+
+func TestParseWhereErrors(t *testing.T) {
+	testCases := []struct {
+		expr string
+		want string
+	}{
+		{expr: "", want: "unexpected end of expression"},
+		{expr: "(pid == 1", want: "unexpected end of expression"},
+		{expr: "pid == 1)", want: `unexpected ")" at position 8`},
+		{expr: "((pid == 1) || pid == 2", want: "unexpected end of expression"},
+		{expr: "pid == 1 &&", want: "unexpected end of expression"},
+		{expr: "pid == 1 ||", want: "unexpected end of expression"},
+		{expr: "pid == 1 !", want: `unexpected "!" at position 9`},
+		{expr: "pid ==", want: "unexpected end of expression"},
+		{expr: "pid 1", want: `unexpected "1" at position 4`},
+		{expr: "== 1", want: `unexpected "==" at position 0`},
+		{expr: "pid == 1 & pid == 2", want: "unexpected character '&' at position 9"},
+		{expr: `user == "root`, want: "unterminated string at position 8"},
+		{expr: `user == "root\"`, want: "unterminated string at position 8"},
+		{expr: `user == "\q"`, want: "invalid string at position 8"},
+		{expr: "nosuch == 1", want: "invalid field: nosuch"},
+		{expr: "count == 1", want: "invalid field: count"},
+		{expr: "rss > lots", want: "invalid size for rss: lots at position 6"},
+		{expr: "pcpu > high", want: "invalid number for pcpu: high"},
+		{expr: `user > "root"`, want: "operator > is not supported for user"},
+		{expr: "start > 2024", want: "comparison is not supported for start at position 0"},
+	}
+	for _, tc := range testCases {
+		expr, _, err := parseWhere(tc.expr)
+		if err == nil {
+			t.Errorf("%q: got %v, want an error", tc.expr, expr)
+		} else if !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%q: got %q, want an error with %q", tc.expr, err, tc.want)
+		}
+	}
+}